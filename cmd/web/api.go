@@ -1,17 +1,36 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/mznrasil/my-blogs-be/internal/filestore"
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/mail"
 	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/scheduler"
+	"github.com/mznrasil/my-blogs-be/internal/services/admin"
+	"github.com/mznrasil/my-blogs-be/internal/services/analytics"
+	"github.com/mznrasil/my-blogs-be/internal/services/categories"
+	"github.com/mznrasil/my-blogs-be/internal/services/comments"
+	"github.com/mznrasil/my-blogs-be/internal/services/media"
 	"github.com/mznrasil/my-blogs-be/internal/services/payments"
 	"github.com/mznrasil/my-blogs-be/internal/services/posts"
 	"github.com/mznrasil/my-blogs-be/internal/services/sites"
+	"github.com/mznrasil/my-blogs-be/internal/services/subscribers"
 	"github.com/mznrasil/my-blogs-be/internal/services/subscriptions"
+	"github.com/mznrasil/my-blogs-be/internal/services/tags"
 	"github.com/mznrasil/my-blogs-be/internal/services/users"
 )
 
@@ -27,7 +46,22 @@ func NewAPIServer(addr string, db *sql.DB) *APIServer {
 	}
 }
 
+const shutdownTimeout = 10 * time.Second
+
 func (s *APIServer) Run() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mailSender, err := mail.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	files, err := filestore.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	router := mux.NewRouter()
 	subRouter := router.PathPrefix("/api/v1").Subrouter()
 	subRouter.Use(middleware.LoggingMiddleware)
@@ -36,15 +70,55 @@ func (s *APIServer) Run() {
 	usersHandler := users.NewHandler(usersStore)
 	usersHandler.RegisterRoutes(subRouter)
 
+	postsStore := posts.NewStore(s.db)
+	postsCache := posts.NewCachedStore(
+		postsStore,
+		helpers.IntFromEnv("POSTS_CACHE_SIZE", 1000),
+		helpers.DurationFromEnv("POSTS_CACHE_TTL", time.Minute),
+	)
+
 	sitesStore := sites.NewStore(s.db)
-	sitesHandler := sites.NewHandler(sitesStore)
+	sitesHandler := sites.NewHandler(sitesStore, postsCache)
 	sitesHandler.RegisterRoutes(subRouter)
 
-	postsStore := posts.NewStore(s.db)
-	postsHandler := posts.NewHandler(postsStore)
+	subscriptionsStore := subscriptions.NewStore(s.db)
+
+	postsHandler := posts.NewHandler(postsCache, subscriptionsStore, sitesStore)
 	postsHandler.RegisterRoutes(subRouter)
 
-	subscriptionsStore := subscriptions.NewStore(s.db)
+	var adminUserIDs []string
+	for _, userID := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if userID = strings.TrimSpace(userID); userID != "" {
+			adminUserIDs = append(adminUserIDs, userID)
+		}
+	}
+	adminHandler := admin.NewHandler(adminUserIDs, postsCache)
+	adminHandler.RegisterRoutes(subRouter)
+
+	tagsStore := tags.NewStore(s.db)
+	tagsHandler := tags.NewHandler(tagsStore)
+	tagsHandler.RegisterRoutes(subRouter)
+
+	categoriesStore := categories.NewStore(s.db)
+	categoriesHandler := categories.NewHandler(categoriesStore)
+	categoriesHandler.RegisterRoutes(subRouter)
+
+	commentsStore := comments.NewStore(s.db)
+	commentsHandler := comments.NewHandler(commentsStore)
+	commentsHandler.RegisterRoutes(subRouter)
+
+	analyticsStore := analytics.NewStore(s.db)
+	trustedProxies, err := analytics.ParseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	analyticsHandler := analytics.NewHandler(
+		analyticsStore,
+		trustedProxies,
+		helpers.DurationFromEnv("VIEW_THROTTLE_WINDOW", 30*time.Minute),
+	)
+	analyticsHandler.RegisterRoutes(subRouter)
+
 	subscriptionsHandler := subscriptions.NewHandler(subscriptionsStore)
 	subscriptionsHandler.RegisterRoutes(subRouter)
 
@@ -52,6 +126,83 @@ func (s *APIServer) Run() {
 	paymentsHandler := payments.NewHandler(paymentsStore)
 	paymentsHandler.RegisterRoutes(subRouter)
 
-	log.Println("Server Listening on PORT", s.addr)
-	http.ListenAndServe(s.addr, subRouter)
+	subscribersStore := subscribers.NewStore(s.db)
+	subscribersHandler := subscribers.NewHandler(subscribersStore, mailSender)
+	subscribersHandler.RegisterRoutes(subRouter)
+
+	mediaStore := media.NewStore(s.db)
+	mediaHandler := media.NewHandler(
+		mediaStore,
+		files,
+		helpers.IntFromEnv("MEDIA_MAX_CONCURRENT_RESIZES", runtime.NumCPU()),
+	)
+	mediaHandler.RegisterRoutes(subRouter)
+
+	var wg sync.WaitGroup
+
+	postScheduler := scheduler.New(
+		postsCache,
+		helpers.DurationFromEnv("POST_SCHEDULER_INTERVAL", time.Minute),
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		postScheduler.Run(ctx)
+	}()
+
+	// sites go first, their posts and media are removed with them; the files
+	// of removed media go last
+	trashPurger := scheduler.NewPurger(
+		helpers.DurationFromEnv("TRASH_PURGE_INTERVAL", time.Hour),
+		helpers.DurationFromEnv("TRASH_RETENTION", 30*24*time.Hour),
+		sitesStore,
+		postsStore,
+		media.NewFileSweeper(mediaStore, files),
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		trashPurger.Run(ctx)
+	}()
+
+	apiBaseURL := strings.TrimSuffix(os.Getenv("API_BASE_URL"), "/")
+	if apiBaseURL == "" {
+		apiBaseURL = "http://localhost" + s.addr
+	}
+	newsletter := scheduler.NewNewsletter(
+		subscribersStore,
+		mailSender,
+		helpers.DurationFromEnv("NEWSLETTER_INTERVAL", time.Minute),
+		helpers.DurationFromEnv("NEWSLETTER_WINDOW", 24*time.Hour),
+		apiBaseURL+"/api/v1",
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		newsletter.Run(ctx)
+	}()
+
+	server := &http.Server{
+		Addr:    s.addr,
+		Handler: subRouter,
+	}
+	go func() {
+		log.Println("Server Listening on PORT", s.addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Println("Server error:", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Failed to shut down server:", err)
+	}
+
+	wg.Wait()
+	log.Println("Server stopped")
 }
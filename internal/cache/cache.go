@@ -0,0 +1,172 @@
+// Package cache keeps recently read values in memory. Entries expire after a
+// TTL, the least recently used ones are evicted once the cache is full, and
+// concurrent misses of the same key share one load.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type Stats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Coalesced uint64 `json:"coalesced"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+type entry[V any] struct {
+	key       string
+	tag       string
+	value     V
+	expiresAt time.Time
+}
+
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	// stale is set when the tag of value was invalidated during the load
+	stale bool
+}
+
+type Cache[V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	tags    map[string]map[string]struct{}
+	calls   map[string]*call[V]
+	// invalidations counts calls to Invalidate, and invalidated holds the
+	// count at the last invalidation of each tag while loads are in flight,
+	// so a load can tell whether its tag was invalidated since it started
+	invalidations uint64
+	invalidated   map[string]uint64
+	stats         Stats
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New returns a cache of at most size entries that live for ttl.
+func New[V any](size int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		size:        max(size, 1),
+		ttl:         ttl,
+		order:       list.New(),
+		entries:     map[string]*list.Element{},
+		tags:        map[string]map[string]struct{}{},
+		calls:       map[string]*call[V]{},
+		invalidated: map[string]uint64{},
+		now:         time.Now,
+	}
+}
+
+// Get returns the value under key, calling load on a miss. load also returns
+// the tag the value is invalidated by. Errors are not cached.
+func (c *Cache[V]) Get(key string, load func() (V, string, error)) (V, error) {
+	for {
+		c.mu.Lock()
+		if element, ok := c.entries[key]; ok {
+			cached := element.Value.(*entry[V])
+			if c.now().Before(cached.expiresAt) {
+				c.order.MoveToFront(element)
+				c.stats.Hits++
+				c.mu.Unlock()
+				return cached.value, nil
+			}
+			c.remove(element)
+		}
+
+		if pending, ok := c.calls[key]; ok {
+			c.stats.Coalesced++
+			c.mu.Unlock()
+			<-pending.done
+			// the shared load may have read what was invalidated since
+			if pending.stale {
+				continue
+			}
+			return pending.value, pending.err
+		}
+
+		c.stats.Misses++
+		pending := &call[V]{done: make(chan struct{})}
+		c.calls[key] = pending
+		started := c.invalidations
+		c.mu.Unlock()
+
+		var tag string
+		pending.value, tag, pending.err = load()
+
+		c.mu.Lock()
+		delete(c.calls, key)
+		pending.stale = c.invalidated[tag] > started
+		if pending.err == nil && !pending.stale {
+			c.add(key, tag, pending.value)
+		}
+		if len(c.calls) == 0 {
+			clear(c.invalidated)
+		}
+		c.mu.Unlock()
+		close(pending.done)
+
+		return pending.value, pending.err
+	}
+}
+
+// Invalidate drops every entry stored under tag. Loads in flight that return
+// a value under tag don't store it.
+func (c *Cache[V]) Invalidate(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.invalidations++
+	if len(c.calls) > 0 {
+		c.invalidated[tag] = c.invalidations
+	}
+	for key := range c.tags[tag] {
+		c.remove(c.entries[key])
+	}
+}
+
+func (c *Cache[V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+func (c *Cache[V]) add(key, tag string, value V) {
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.order.PushFront(&entry[V]{
+		key:       key,
+		tag:       tag,
+		value:     value,
+		expiresAt: c.now().Add(c.ttl),
+	})
+	if c.tags[tag] == nil {
+		c.tags[tag] = map[string]struct{}{}
+	}
+	c.tags[tag][key] = struct{}{}
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache[V]) remove(element *list.Element) {
+	removed := c.order.Remove(element).(*entry[V])
+	delete(c.entries, removed.key)
+	delete(c.tags[removed.tag], removed.key)
+	if len(c.tags[removed.tag]) == 0 {
+		delete(c.tags, removed.tag)
+	}
+}
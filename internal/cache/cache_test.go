@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loader counts the loads of each key and returns "<key>:<count>", tagged
+// with the key's first byte.
+type loader struct {
+	mu    sync.Mutex
+	loads map[string]int
+}
+
+func newLoader() *loader {
+	return &loader{loads: map[string]int{}}
+}
+
+func (l *loader) load(key string) func() (string, string, error) {
+	return func() (string, string, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		l.loads[key]++
+		return key + ":" + string(rune('0'+l.loads[key])), key[:1], nil
+	}
+}
+
+func (l *loader) count(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.loads[key]
+}
+
+func get(t *testing.T, c *Cache[string], l *loader, key, want string) {
+	t.Helper()
+
+	got, err := c.Get(key, l.load(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("Get(%q) = %q, want %q", key, got, want)
+	}
+}
+
+// waitFor polls until done reports true, since there is no event for a
+// goroutine having blocked in Get.
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGetCachesValues(t *testing.T) {
+	c := New[string](10, time.Minute)
+	l := newLoader()
+
+	get(t, c, l, "a", "a:1")
+	get(t, c, l, "a", "a:1")
+	get(t, c, l, "b", "b:1")
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 1 hit, 2 misses, 2 entries", stats)
+	}
+}
+
+func TestGetDoesNotCacheErrors(t *testing.T) {
+	c := New[string](10, time.Minute)
+	loads := 0
+	failing := func() (string, string, error) {
+		loads++
+		return "", "", errors.New("failed")
+	}
+
+	for range 2 {
+		if _, err := c.Get("a", failing); err == nil {
+			t.Fatal("Get() returned no error")
+		}
+	}
+	if loads != 2 {
+		t.Errorf("load called %d times, want 2", loads)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := New[string](10, time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	l := newLoader()
+
+	get(t, c, l, "a", "a:1")
+	now = now.Add(time.Minute - time.Nanosecond)
+	get(t, c, l, "a", "a:1")
+	now = now.Add(time.Nanosecond)
+	get(t, c, l, "a", "a:2")
+
+	if entries := c.Stats().Entries; entries != 1 {
+		t.Errorf("Stats().Entries = %d, want 1", entries)
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string](2, time.Minute)
+	l := newLoader()
+
+	get(t, c, l, "a", "a:1")
+	get(t, c, l, "b", "b:1")
+	// reading a makes b the least recently used
+	get(t, c, l, "a", "a:1")
+	get(t, c, l, "c", "c:1")
+
+	get(t, c, l, "a", "a:1")
+	get(t, c, l, "c", "c:1")
+	get(t, c, l, "b", "b:2")
+
+	stats := c.Stats()
+	if stats.Evictions != 2 || stats.Entries != 2 {
+		t.Errorf("Stats() = %+v, want 2 evictions, 2 entries", stats)
+	}
+}
+
+func TestInvalidateDropsTag(t *testing.T) {
+	c := New[string](10, time.Minute)
+	l := newLoader()
+
+	get(t, c, l, "a1", "a1:1")
+	get(t, c, l, "a2", "a2:1")
+	get(t, c, l, "b1", "b1:1")
+
+	c.Invalidate("a")
+
+	get(t, c, l, "a1", "a1:2")
+	get(t, c, l, "a2", "a2:2")
+	get(t, c, l, "b1", "b1:1")
+}
+
+func TestCoalescesConcurrentMisses(t *testing.T) {
+	c := New[string](10, time.Minute)
+	release := make(chan struct{})
+	loads := 0
+	load := func() (string, string, error) {
+		loads++
+		<-release
+		return "value", "tag", nil
+	}
+
+	const readers = 10
+	var wg sync.WaitGroup
+	results := make([]string, readers)
+	for i := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = c.Get("a", load)
+		}()
+	}
+
+	waitFor(t, func() bool {
+		stats := c.Stats()
+		return stats.Misses == 1 && stats.Coalesced == readers-1
+	})
+	close(release)
+	wg.Wait()
+
+	if loads != 1 {
+		t.Errorf("load called %d times, want 1", loads)
+	}
+	for i, result := range results {
+		if result != "value" {
+			t.Errorf("reader %d got %q, want %q", i, result, "value")
+		}
+	}
+}
+
+func TestInvalidateDuringLoad(t *testing.T) {
+	c := New[string](10, time.Minute)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loads := 0
+	load := func() (string, string, error) {
+		loads++
+		if loads == 1 {
+			close(started)
+			<-release
+			return "old", "a", nil
+		}
+		return "new", "a", nil
+	}
+
+	first := make(chan string)
+	go func() {
+		value, _ := c.Get("a1", load)
+		first <- value
+	}()
+	<-started
+
+	c.Invalidate("a")
+
+	// a reader coming after the invalidation joins the load in flight, but
+	// must not get what it read
+	second := make(chan string)
+	go func() {
+		value, _ := c.Get("a1", load)
+		second <- value
+	}()
+	waitFor(t, func() bool { return c.Stats().Coalesced == 1 })
+
+	close(release)
+	if value := <-first; value != "old" {
+		t.Errorf("first Get() = %q, want %q", value, "old")
+	}
+	if value := <-second; value != "new" {
+		t.Errorf("second Get() = %q, want %q", value, "new")
+	}
+
+	got, err := c.Get("a1", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "new" {
+		t.Errorf("Get() after the loads = %q, want %q", got, "new")
+	}
+	if loads != 2 {
+		t.Errorf("load called %d times, want 2", loads)
+	}
+}
+
+func TestInvalidateOtherTagDuringLoad(t *testing.T) {
+	c := New[string](10, time.Minute)
+	release := make(chan struct{})
+	loads := 0
+	load := func() (string, string, error) {
+		loads++
+		<-release
+		return "value", "a", nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Get("a1", load)
+		close(done)
+	}()
+	waitFor(t, func() bool { return c.Stats().Misses == 1 })
+
+	c.Invalidate("b")
+	close(release)
+	<-done
+
+	got, err := c.Get("a1", load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "value" || loads != 1 {
+		t.Errorf("Get() = %q after %d loads, want the stored value after 1", got, loads)
+	}
+}
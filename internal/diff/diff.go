@@ -0,0 +1,150 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+)
+
+// Change describes a single difference between two decoded JSON documents.
+// Path is a JSON pointer into the new document, except for removals where it
+// points into the old one.
+type Change struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+// JSON compares two values produced by encoding/json (maps, slices, strings,
+// float64, bool and nil) and returns the changes needed to turn from into to.
+func JSON(from, to any) []Change {
+	changes := []Change{}
+	compare("", from, to, &changes)
+	return changes
+}
+
+func compare(path string, from, to any, changes *[]Change) {
+	if reflect.DeepEqual(from, to) {
+		return
+	}
+
+	switch fromValue := from.(type) {
+	case map[string]any:
+		if toValue, ok := to.(map[string]any); ok {
+			compareObjects(path, fromValue, toValue, changes)
+			return
+		}
+	case []any:
+		if toValue, ok := to.([]any); ok {
+			compareArrays(path, fromValue, toValue, changes)
+			return
+		}
+	}
+
+	*changes = append(*changes, Change{Op: OpReplace, Path: path, From: from, To: to})
+}
+
+func compareObjects(path string, from, to map[string]any, changes *[]Change) {
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fromValue, inFrom := from[key]
+		toValue, inTo := to[key]
+		keyPath := path + "/" + escape(key)
+
+		switch {
+		case inFrom && !inTo:
+			*changes = append(*changes, Change{Op: OpRemove, Path: keyPath, From: fromValue})
+		case !inFrom && inTo:
+			*changes = append(*changes, Change{Op: OpAdd, Path: keyPath, To: toValue})
+		default:
+			compare(keyPath, fromValue, toValue, changes)
+		}
+	}
+}
+
+// compareArrays aligns both arrays on their longest common subsequence so an
+// inserted paragraph shows up as one addition instead of every following
+// block being reported as replaced.
+func compareArrays(path string, from, to []any, changes *[]Change) {
+	lengths := make([][]int, len(from)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if reflect.DeepEqual(from[i], to[j]) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		if i < len(from) && j < len(to) && reflect.DeepEqual(from[i], to[j]) {
+			i++
+			j++
+			continue
+		}
+
+		// collect the gap between two matched elements
+		fromStart, toStart := i, j
+		for i < len(from) || j < len(to) {
+			if i < len(from) && j < len(to) && reflect.DeepEqual(from[i], to[j]) {
+				break
+			}
+			if j == len(to) || (i < len(from) && lengths[i+1][j] >= lengths[i][j+1]) {
+				i++
+			} else {
+				j++
+			}
+		}
+
+		removed, added := from[fromStart:i], to[toStart:j]
+		paired := min(len(removed), len(added))
+		for k := 0; k < paired; k++ {
+			compare(indexPath(path, toStart+k), removed[k], added[k], changes)
+		}
+		for k := paired; k < len(removed); k++ {
+			*changes = append(*changes, Change{
+				Op:   OpRemove,
+				Path: indexPath(path, fromStart+k),
+				From: removed[k],
+			})
+		}
+		for k := paired; k < len(added); k++ {
+			*changes = append(*changes, Change{
+				Op:   OpAdd,
+				Path: indexPath(path, toStart+k),
+				To:   added[k],
+			})
+		}
+	}
+}
+
+func indexPath(path string, index int) string {
+	return fmt.Sprintf("%v/%d", path, index)
+}
+
+func escape(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
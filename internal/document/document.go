@@ -0,0 +1,82 @@
+// Package document models the rich-text editor's JSON documents stored in
+// posts.article_content.
+//
+// Documents are ProseMirror style node trees: every node has a type, optional
+// attrs and either child content or, for text nodes, text and marks.
+package document
+
+import "encoding/json"
+
+type Node struct {
+	Type    string         `json:"type"`
+	Attrs   map[string]any `json:"attrs,omitempty"`
+	Content []Node         `json:"content,omitempty"`
+	Text    string         `json:"text,omitempty"`
+	Marks   []Mark         `json:"marks,omitempty"`
+}
+
+type Mark struct {
+	Type  string         `json:"type"`
+	Attrs map[string]any `json:"attrs,omitempty"`
+}
+
+// Decode accepts a decoded document, raw JSON or a JSON string, which
+// covers every shape article_content takes between the API and the store.
+func Decode(value any) (Node, error) {
+	var root Node
+
+	var raw []byte
+	switch value := value.(type) {
+	case nil:
+		return root, nil
+	case Node:
+		return value, nil
+	case []byte:
+		raw = value
+	case json.RawMessage:
+		raw = value
+	case string:
+		raw = []byte(value)
+	default:
+		marshalled, err := json.Marshal(value)
+		if err != nil {
+			return root, err
+		}
+		raw = marshalled
+	}
+
+	err := json.Unmarshal(raw, &root)
+	return root, err
+}
+
+func (n Node) StringAttr(key string) string {
+	value, _ := n.Attrs[key].(string)
+	return value
+}
+
+func (n Node) IntAttr(key string, fallback int) int {
+	switch value := n.Attrs[key].(type) {
+	case float64:
+		return int(value)
+	case int:
+		return value
+	}
+
+	return fallback
+}
+
+func (m Mark) StringAttr(key string) string {
+	value, _ := m.Attrs[key].(string)
+	return value
+}
+
+// Truncate keeps the first n top-level blocks of a document and reports
+// whether anything was cut.
+func Truncate(root Node, n int) (Node, bool) {
+	if n < 0 || len(root.Content) <= n {
+		return root, false
+	}
+
+	root.Content = root.Content[:n]
+	return root, true
+}
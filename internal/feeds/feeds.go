@@ -0,0 +1,176 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Feed is the format independent description of a site's latest posts.
+type Feed struct {
+	Title       string
+	Link        string
+	SelfLink    string
+	NextLink    string
+	Description string
+	Updated     time.Time
+	Items       []Item
+}
+
+type Item struct {
+	ID          string
+	Title       string
+	Link        string
+	Description string
+	Content     string
+	Image       string
+	Published   time.Time
+	Updated     time.Time
+}
+
+type rss struct {
+	XMLName       xml.Name   `xml:"rss"`
+	Version       string     `xml:"version,attr"`
+	AtomNamespace string     `xml:"xmlns:atom,attr"`
+	ContentModule string     `xml:"xmlns:content,attr"`
+	Channel       rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title          string  `xml:"title"`
+	Link           string  `xml:"link"`
+	GUID           rssGUID `xml:"guid"`
+	Description    string  `xml:"description"`
+	PubDate        string  `xml:"pubDate"`
+	ContentEncoded *cdata  `xml:"content:encoded,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string    `xml:"title"`
+	ID        string    `xml:"id"`
+	Link      atomLink  `xml:"link"`
+	Published string    `xml:"published"`
+	Updated   string    `xml:"updated"`
+	Summary   string    `xml:"summary,omitempty"`
+	Content   *atomText `xml:"content,omitempty"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func RSS(feed Feed) ([]byte, error) {
+	channel := rssChannel{
+		Title:       feed.Title,
+		Link:        feed.Link,
+		Description: feed.Description,
+		AtomLink: atomLink{
+			Href: feed.SelfLink,
+			Rel:  "self",
+			Type: "application/rss+xml",
+		},
+	}
+	if !feed.Updated.IsZero() {
+		channel.LastBuildDate = feed.Updated.Format(time.RFC1123Z)
+	}
+
+	for _, item := range feed.Items {
+		rssItem := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: "true", Value: item.Link},
+			Description: item.Description,
+			PubDate:     item.Published.Format(time.RFC1123Z),
+		}
+		if item.Content != "" {
+			rssItem.ContentEncoded = &cdata{Value: item.Content}
+		}
+		channel.Items = append(channel.Items, rssItem)
+	}
+
+	return encode(rss{
+		Version:       "2.0",
+		AtomNamespace: "http://www.w3.org/2005/Atom",
+		ContentModule: "http://purl.org/rss/1.0/modules/content/",
+		Channel:       channel,
+	})
+}
+
+func Atom(feed Feed) ([]byte, error) {
+	atom := atomFeed{
+		XMLNS: "http://www.w3.org/2005/Atom",
+		Title: feed.Title,
+		ID:    feed.Link,
+		Links: []atomLink{
+			{Href: feed.Link, Rel: "alternate", Type: "text/html"},
+			{Href: feed.SelfLink, Rel: "self", Type: "application/atom+xml"},
+		},
+		Updated: feed.Updated.Format(time.RFC3339),
+		Author:  atomAuthor{Name: feed.Title},
+	}
+
+	for _, item := range feed.Items {
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        "urn:uuid:" + item.ID,
+			Link:      atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Published: item.Published.Format(time.RFC3339),
+			Updated:   item.Updated.Format(time.RFC3339),
+			Summary:   item.Description,
+		}
+		if item.Content != "" {
+			entry.Content = &atomText{Type: "html", Value: item.Content}
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	return encode(atom)
+}
+
+func encode(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,71 @@
+package feeds
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	NextURL     string         `json:"next_url,omitempty"`
+	Authors     []jsonAuthor   `json:"authors,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string  `json:"id"`
+	URL           string  `json:"url"`
+	Title         string  `json:"title"`
+	ContentHTML   string  `json:"content_html,omitempty"`
+	ContentText   *string `json:"content_text,omitempty"`
+	Summary       string  `json:"summary,omitempty"`
+	Image         string  `json:"image,omitempty"`
+	DatePublished string  `json:"date_published"`
+	DateModified  string  `json:"date_modified"`
+}
+
+// JSON encodes the feed as a JSON Feed 1.1 document. Items carry their
+// content as content_html, the spec requires either it or content_text so
+// items without content carry their description as text.
+func JSON(feed Feed) ([]byte, error) {
+	document := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       feed.Title,
+		HomePageURL: feed.Link,
+		FeedURL:     feed.SelfLink,
+		Description: feed.Description,
+		NextURL:     feed.NextLink,
+		Authors:     []jsonAuthor{{Name: feed.Title}},
+		Items:       []jsonFeedItem{},
+	}
+
+	for _, item := range feed.Items {
+		jsonItem := jsonFeedItem{
+			ID:            item.ID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			Summary:       item.Description,
+			Image:         item.Image,
+			DatePublished: item.Published.Format(time.RFC3339),
+			DateModified:  item.Updated.Format(time.RFC3339),
+		}
+		if item.Content == "" {
+			jsonItem.ContentText = &item.Description
+			jsonItem.Summary = ""
+		}
+		document.Items = append(document.Items, jsonItem)
+	}
+
+	return json.MarshalIndent(document, "", "  ")
+}
@@ -0,0 +1,125 @@
+// Package filestore keeps uploaded files. Keys are slash separated paths
+// chosen by the caller; Local stores them on disk, other backends such as S3
+// only need to implement Store.
+package filestore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrNotFound   = errors.New("File not found")
+	ErrInvalidKey = errors.New("Invalid file key")
+)
+
+type Store interface {
+	// Put stores everything read from r under key and returns its size.
+	Put(key string, r io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(key string) error
+}
+
+// FromEnv returns the store selected by FILESTORE_DRIVER. Only "local", the
+// default, exists so far; it keeps files under FILESTORE_DIR.
+func FromEnv() (Store, error) {
+	switch driver := os.Getenv("FILESTORE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("FILESTORE_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocal(dir)
+	default:
+		return nil, errors.New("Unknown FILESTORE_DRIVER " + driver)
+	}
+}
+
+type Local struct {
+	root string
+}
+
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Local{
+		root: root,
+	}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	path := filepath.FromSlash(key)
+	if key == "" || !filepath.IsLocal(path) {
+		return "", ErrInvalidKey
+	}
+
+	return filepath.Join(l.root, path), nil
+}
+
+// Put writes to a temporary file first, so a failed upload never leaves a
+// partial file behind under key.
+func (l *Local) Put(key string, r io.Reader) (int64, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+
+	size, err := io.Copy(file, r)
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+	if err = file.Close(); err != nil {
+		return 0, err
+	}
+
+	if err = os.Rename(file.Name(), path); err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+func (l *Local) Open(key string) (io.ReadCloser, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (l *Local) Delete(key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
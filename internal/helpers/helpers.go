@@ -1,11 +1,23 @@
 package helpers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
 )
 
 var Validate = validator.New()
@@ -38,9 +50,11 @@ func WriteJSONError(w http.ResponseWriter, code int, message string) error {
 }
 
 type APISuccess struct {
-	Data    any    `json:"data"`
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Data       any    `json:"data"`
+	Code       int    `json:"code"`
+	Message    string `json:"message"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    *bool  `json:"has_more,omitempty"`
 }
 
 func WriteJSONSuccess(w http.ResponseWriter, code int, message string, data any) error {
@@ -50,3 +64,267 @@ func WriteJSONSuccess(w http.ResponseWriter, code int, message string, data any)
 		Message: message,
 	})
 }
+
+func WriteJSONPage(
+	w http.ResponseWriter,
+	code int,
+	message string,
+	data any,
+	page pagination.Page,
+) error {
+	return WriteJSON(w, code, APISuccess{
+		Data:       data,
+		Code:       code,
+		Message:    message,
+		NextCursor: page.NextCursor,
+		HasMore:    &page.HasMore,
+	})
+}
+
+func DurationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid duration for %v, using %v: %v", key, fallback, err)
+		return fallback
+	}
+
+	return duration
+}
+
+func IntFromEnv(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid number for %v, using %v: %v", key, fallback, err)
+		return fallback
+	}
+
+	return number
+}
+
+// transliterations covers letters that Unicode does not decompose into a
+// base letter and accents.
+var transliterations = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'œ': "oe",
+	'ø': "o",
+	'đ': "d",
+	'ð': "d",
+	'ł': "l",
+	'þ': "th",
+	'ı': "i",
+}
+
+// Slugify lowercases a value and keeps ASCII letters and digits, separated
+// by single dashes. Accented letters lose their accents, so "Crème brûlée"
+// becomes "creme-brulee".
+func Slugify(value string) string {
+	var slug strings.Builder
+	lastDash := true
+	write := func(s string) {
+		for _, r := range s {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+				slug.WriteRune(r)
+				lastDash = false
+			case unicode.Is(unicode.Mn, r):
+				// combining accents left over from decomposition
+			case !lastDash:
+				slug.WriteRune('-')
+				lastDash = true
+			}
+		}
+	}
+
+	for _, r := range norm.NFKD.String(strings.ToLower(value)) {
+		if replacement, ok := transliterations[r]; ok {
+			write(replacement)
+			continue
+		}
+		write(string(r))
+	}
+
+	return strings.TrimSuffix(slug.String(), "-")
+}
+
+// TopicSlug is Slugify for tag and category names. Names without any Latin
+// letters or digits, such as "Новости" or "日本語", keep their own letters
+// rather than ending up with an empty slug. It is empty only for names
+// without any letters or digits.
+func TopicSlug(name string) string {
+	if slug := Slugify(name); slug != "" {
+		return slug
+	}
+
+	var slug strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+			slug.WriteRune(r)
+			lastDash = false
+		case !lastDash:
+			slug.WriteRune('-')
+			lastDash = true
+		}
+	}
+
+	return strings.TrimSuffix(slug.String(), "-")
+}
+
+// SiteURL is the public address of a site. SITE_BASE_URL may contain a
+// {subdirectory} placeholder for per-site hosts, otherwise the subdirectory
+// is appended as a path.
+func SiteURL(subdirectory string) string {
+	baseURL := strings.TrimSuffix(os.Getenv("SITE_BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
+	if strings.Contains(baseURL, "{subdirectory}") {
+		return strings.ReplaceAll(baseURL, "{subdirectory}", subdirectory)
+	}
+
+	return baseURL + "/" + subdirectory
+}
+
+func PostURL(subdirectory, slug string) string {
+	return SiteURL(subdirectory) + "/" + slug
+}
+
+// APIBaseURL is the public origin of the API, preferring API_BASE_URL when
+// the server sits behind a proxy.
+func APIBaseURL(r *http.Request) string {
+	baseURL := strings.TrimSuffix(os.Getenv("API_BASE_URL"), "/")
+	if baseURL != "" {
+		return baseURL
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// APIRootURL is the absolute URL the API routes are mounted under. route is
+// the part of the request path the handler's route matched.
+func APIRootURL(r *http.Request, route string) string {
+	return APIBaseURL(r) + strings.TrimSuffix(r.URL.Path, route)
+}
+
+// WriteSiteMoved answers with a permanent redirect to the requested URL under
+// the site's current subdirectory, swapped in where the route has its
+// {subdirectory} variable.
+func WriteSiteMoved(w http.ResponseWriter, r *http.Request, subdirectory string) {
+	location := *r.URL
+	segments := strings.Split(r.URL.Path, "/")
+	if route := mux.CurrentRoute(r); route != nil {
+		template, _ := route.GetPathTemplate()
+		for i, segment := range strings.Split(template, "/") {
+			if segment == "{subdirectory}" && i < len(segments) {
+				segments[i] = subdirectory
+			}
+		}
+	}
+	location.Path = strings.Join(segments, "/")
+	location.RawPath = ""
+
+	w.Header().Set("Location", APIBaseURL(r)+location.RequestURI())
+	WriteJSONSuccess(
+		w,
+		http.StatusMovedPermanently,
+		"Site has moved",
+		map[string]string{"subdirectory": subdirectory},
+	)
+}
+
+// RequestURL rebuilds the absolute URL of an API request.
+func RequestURL(r *http.Request) string {
+	return APIBaseURL(r) + r.URL.RequestURI()
+}
+
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// CheckNotModified sets the validator headers and answers 304 when the
+// client already has the current representation.
+func CheckNotModified(
+	w http.ResponseWriter,
+	r *http.Request,
+	etag string,
+	lastModified time.Time,
+) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if !etagMatches(match, etag) {
+			return false
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !lastModified.IsZero() {
+		sinceTime, err := http.ParseTime(since)
+		if err == nil && !lastModified.Truncate(time.Second).After(sinceTime) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// PublicCacheControl lets browsers and proxies reuse public content for
+// PUBLIC_CACHE_MAX_AGE, and serve it stale for PUBLIC_CACHE_SWR more while
+// they revalidate it in the background.
+func PublicCacheControl() string {
+	maxAge := DurationFromEnv("PUBLIC_CACHE_MAX_AGE", time.Minute)
+	staleWhileRevalidate := DurationFromEnv("PUBLIC_CACHE_SWR", 5*time.Minute)
+	return fmt.Sprintf(
+		"public, max-age=%d, stale-while-revalidate=%d",
+		int(maxAge.Seconds()),
+		int(staleWhileRevalidate.Seconds()),
+	)
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IfMatch compares an If-Match header with etag. Unlike If-None-Match it
+// uses the strong comparison, so weak validators never match, and it does
+// not accept "*": callers must name the version their change is based on.
+func IfMatch(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimSpace(candidate) == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIfMatch(t *testing.T) {
+	etag := `"v2"`
+
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"v2"`, true},
+		{`"v1", "v2"`, true},
+		{`"v1"`, false},
+		{`W/"v2"`, false},
+		{`*`, false},
+		{``, false},
+	}
+
+	for _, test := range tests {
+		if got := IfMatch(test.header, etag); got != test.want {
+			t.Errorf("IfMatch(%q, %q) = %v, want %v", test.header, etag, got, test.want)
+		}
+	}
+}
+
+func TestCheckNotModified(t *testing.T) {
+	etag := `"v2"`
+	lastModified := time.Date(2024, 10, 30, 12, 0, 0, 500_000_000, time.UTC)
+	httpDate := func(at time.Time) string { return at.Format(http.TimeFormat) }
+
+	tests := []struct {
+		name         string
+		ifNoneMatch  string
+		ifModified   string
+		lastModified time.Time
+		want         bool
+	}{
+		{name: "unconditional", lastModified: lastModified},
+		{name: "matching ETag", ifNoneMatch: `"v1", "v2"`, want: true},
+		{name: "weak ETag", ifNoneMatch: `W/"v2"`, want: true},
+		{name: "any ETag", ifNoneMatch: `*`, want: true},
+		{name: "stale ETag", ifNoneMatch: `"v1"`},
+		{
+			name:         "stale ETag wins over a current date",
+			ifNoneMatch:  `"v1"`,
+			ifModified:   httpDate(lastModified),
+			lastModified: lastModified,
+		},
+		{
+			name:         "unchanged since",
+			ifModified:   httpDate(lastModified),
+			lastModified: lastModified,
+			want:         true,
+		},
+		{
+			name:         "changed since",
+			ifModified:   httpDate(lastModified.Add(-time.Second)),
+			lastModified: lastModified,
+		},
+		{name: "date without a last modification", ifModified: httpDate(lastModified)},
+		{name: "invalid date", ifModified: "yesterday", lastModified: lastModified},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if test.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		if test.ifModified != "" {
+			r.Header.Set("If-Modified-Since", test.ifModified)
+		}
+		w := httptest.NewRecorder()
+
+		if got := CheckNotModified(w, r, etag, test.lastModified); got != test.want {
+			t.Errorf("%v: CheckNotModified() = %v, want %v", test.name, got, test.want)
+		}
+		if test.want && w.Code != http.StatusNotModified {
+			t.Errorf("%v: status = %d, want %d", test.name, w.Code, http.StatusNotModified)
+		}
+		if got := w.Header().Get("ETag"); got != etag {
+			t.Errorf("%v: ETag = %q, want %q", test.name, got, etag)
+		}
+		wantLastModified := ""
+		if !test.lastModified.IsZero() {
+			wantLastModified = httpDate(test.lastModified)
+		}
+		if got := w.Header().Get("Last-Modified"); got != wantLastModified {
+			t.Errorf("%v: Last-Modified = %q, want %q", test.name, got, wantLastModified)
+		}
+	}
+}
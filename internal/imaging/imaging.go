@@ -0,0 +1,123 @@
+// Package imaging resizes uploaded images into the variants served for
+// responsive images. Everything is pure Go: decoding uses the standard
+// library, scaling golang.org/x/image/draw and WebP encoding nativewebp, which
+// only writes lossless WebP. That loses to JPEG on most photos, so callers
+// keep a WebP variant only when it comes out smaller.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	_ "image/gif"
+
+	"github.com/HugoSmits86/nativewebp"
+	xdraw "golang.org/x/image/draw"
+)
+
+// Widths are the variants made for every uploaded image that is wider.
+var Widths = []int{320, 640, 1280}
+
+// MaxPixels bounds the images that are decoded at all, since a small file can
+// declare a huge canvas.
+const MaxPixels = 40_000_000
+
+var ErrTooLarge = errors.New("Image is too large to resize")
+
+type Format struct {
+	Ext      string
+	MimeType string
+}
+
+var (
+	JPEG = Format{Ext: "jpg", MimeType: "image/jpeg"}
+	PNG  = Format{Ext: "png", MimeType: "image/png"}
+	WebP = Format{Ext: "webp", MimeType: "image/webp"}
+)
+
+func FormatByName(name string) (Format, bool) {
+	switch name {
+	case "jpg", "jpeg":
+		return JPEG, true
+	case "png":
+		return PNG, true
+	case "webp":
+		return WebP, true
+	}
+
+	return Format{}, false
+}
+
+// FallbackFormat is the format variants for browsers without WebP support
+// use. Only JPEG stays JPEG, everything else may have transparency.
+func FallbackFormat(mimeType string) Format {
+	if mimeType == JPEG.MimeType {
+		return JPEG
+	}
+
+	return PNG
+}
+
+func IsImage(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+
+	return false
+}
+
+func DecodeConfig(data []byte) (int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return config.Width, config.Height, nil
+}
+
+// Decode decodes an image, refusing ones above MaxPixels. Animated GIFs
+// yield their first frame.
+func Decode(data []byte) (image.Image, error) {
+	width, height, err := DecodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	if width*height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Resize scales img down to width, keeping its aspect ratio. Images are
+// never scaled up.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	if width >= bounds.Dx() {
+		return img
+	}
+
+	height := max(1, (bounds.Dy()*width+bounds.Dx()/2)/bounds.Dx())
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+
+	return resized
+}
+
+func Encode(w io.Writer, img image.Image, format Format) error {
+	switch format {
+	case JPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 82})
+	case WebP:
+		return nativewebp.Encode(w, img, nil)
+	default:
+		return png.Encode(w, img)
+	}
+}
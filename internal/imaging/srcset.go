@@ -0,0 +1,98 @@
+package imaging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+// MediaURL is where an uploaded file is served. root is the URL the API
+// routes are mounted under.
+func MediaURL(root, mediaID, filename string) string {
+	return root + "/media/" + mediaID + "/" + url.PathEscape(filename)
+}
+
+func VariantURL(root, mediaID, name string) string {
+	return root + "/media/" + mediaID + "/variants/" + name
+}
+
+// VariantName names the variant of width in format, e.g. "640.webp".
+func VariantName(width int, format Format) string {
+	return fmt.Sprintf("%d.%v", width, format.Ext)
+}
+
+type storedImageSet struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Variants []struct {
+		Name     string `json:"name"`
+		Width    int    `json:"width"`
+		MimeType string `json:"mime_type"`
+	} `json:"variants"`
+}
+
+// NewImageSet turns what media_image_set(imageURL) returned into srcset
+// strings, one source per type with WebP first, ready for a <picture>.
+// The variant URLs share imageURL's origin. It returns nil when imageURL is not
+// an uploaded image.
+func NewImageSet(imageURL string, raw []byte) (*models.ImageSet, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var stored storedImageSet
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, err
+	}
+
+	index := strings.Index(imageURL, "/media/"+stored.ID+"/")
+	if index < 0 {
+		return nil, nil
+	}
+	root := imageURL[:index]
+
+	imageSet := &models.ImageSet{
+		Src:     imageURL,
+		Width:   stored.Width,
+		Height:  stored.Height,
+		Sources: []models.ImageSource{},
+	}
+	srcsets := map[string][]string{}
+	var types []string
+	for _, variant := range stored.Variants {
+		if _, ok := srcsets[variant.MimeType]; !ok {
+			types = append(types, variant.MimeType)
+		}
+		srcsets[variant.MimeType] = append(
+			srcsets[variant.MimeType],
+			fmt.Sprintf("%v %dw", VariantURL(root, stored.ID, variant.Name), variant.Width),
+		)
+	}
+
+	// the original is the largest candidate of its own type
+	if _, ok := srcsets[stored.MimeType]; ok {
+		srcsets[stored.MimeType] = append(
+			srcsets[stored.MimeType],
+			fmt.Sprintf("%v %dw", imageURL, stored.Width),
+		)
+	}
+
+	for _, mimeType := range types {
+		source := models.ImageSource{
+			Type:   mimeType,
+			SrcSet: strings.Join(srcsets[mimeType], ", "),
+		}
+		if mimeType == WebP.MimeType {
+			imageSet.Sources = append([]models.ImageSource{source}, imageSet.Sources...)
+			continue
+		}
+		imageSet.Sources = append(imageSet.Sources, source)
+	}
+
+	return imageSet, nil
+}
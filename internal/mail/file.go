@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileSender writes every message to its own .eml file, which mail clients
+// open as-is.
+type FileSender struct {
+	dir  string
+	from string
+}
+
+func NewFileSender(dir, from string) (*FileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &FileSender{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (s *FileSender) Send(msg Message) error {
+	now := time.Now()
+	body, err := msg.Bytes(s.from, now)
+	if err != nil {
+		return err
+	}
+
+	random := make([]byte, 4)
+	if _, err = rand.Read(random); err != nil {
+		return err
+	}
+	name := now.UTC().Format("20060102T150405.000000000") + "-" + hex.EncodeToString(random) + ".eml"
+
+	return os.WriteFile(filepath.Join(s.dir, name), body, 0o644)
+}
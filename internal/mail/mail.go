@@ -0,0 +1,158 @@
+// Package mail sends email through a pluggable Sender. SMTPSender delivers
+// it, FileSender and MemorySender keep it around for development and tests.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrInvalidHeader = errors.New("Mail header contains a line break")
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are added as-is, e.g. List-Unsubscribe
+	Headers map[string]string
+}
+
+type Sender interface {
+	Send(msg Message) error
+}
+
+// FromEnv picks a sender with MAIL_DRIVER: smtp, file or memory, which only
+// logs what would have been sent. There is no default, so a deployment that
+// forgets the setting fails to start instead of silently dropping mail.
+func FromEnv() (Sender, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPSender(
+			os.Getenv("SMTP_HOST"),
+			port,
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFileSender(dir, from)
+	case "memory":
+		log.Println("Mail is kept in memory, set MAIL_DRIVER to smtp to deliver it")
+		return NewMemorySender(), nil
+	case "":
+		return nil, errors.New("MAIL_DRIVER is not set, use smtp, file or memory")
+	default:
+		return nil, fmt.Errorf("Unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// Bytes renders msg as a MIME message with a plain text and, when set, an
+// HTML alternative.
+func (msg Message) Bytes(from string, now time.Time) ([]byte, error) {
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         now.Format(time.RFC1123Z),
+		"Message-ID":   messageID(from),
+		"MIME-Version": "1.0",
+	}
+	for key, value := range msg.Headers {
+		headers[textproto.CanonicalMIMEHeaderKey(key)] = value
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	if msg.HTML == "" {
+		headers["Content-Type"] = "text/plain; charset=utf-8"
+		headers["Content-Transfer-Encoding"] = "quoted-printable"
+		if err := writeQuotedPrintable(&body, msg.Text); err != nil {
+			return nil, err
+		}
+	} else {
+		headers["Content-Type"] = "multipart/alternative; boundary=" + parts.Boundary()
+		for _, part := range []struct{ contentType, content string }{
+			{"text/plain; charset=utf-8", msg.Text},
+			{"text/html; charset=utf-8", msg.HTML},
+		} {
+			writer, err := parts.CreatePart(textproto.MIMEHeader{
+				"Content-Type":              {part.contentType},
+				"Content-Transfer-Encoding": {"quoted-printable"},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err = writeQuotedPrintable(writer, part.content); err != nil {
+				return nil, err
+			}
+		}
+		if err := parts.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key, value := range headers {
+		if strings.ContainsAny(key+value, "\r\n") {
+			return nil, ErrInvalidHeader
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var message bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&message, "%v: %v\r\n", key, headers[key])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	writer := quotedprintable.NewWriter(w)
+	if _, err := writer.Write([]byte(content)); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func messageID(from string) string {
+	random := make([]byte, 16)
+	rand.Read(random)
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
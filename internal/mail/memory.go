@@ -0,0 +1,34 @@
+package mail
+
+import (
+	"log"
+	"sync"
+)
+
+// MemorySender keeps sent messages in memory, for tests and local setups
+// without a mail server.
+type MemorySender struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemorySender() *MemorySender {
+	return &MemorySender{}
+}
+
+func (s *MemorySender) Send(msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Printf("Mail to %v: %v", msg.To, msg.Subject)
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+// Messages returns everything sent so far, oldest first.
+func (s *MemorySender) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
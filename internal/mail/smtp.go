@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+type SMTPSender struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPSender delivers through an SMTP relay. Without a username it sends
+// unauthenticated; STARTTLS is used whenever the server offers it.
+func NewSMTPSender(host, port, username, password, from string) (*SMTPSender, error) {
+	if host == "" {
+		return nil, errors.New("SMTP_HOST is not set")
+	}
+
+	sender := &SMTPSender{
+		addr: net.JoinHostPort(host, port),
+		from: from,
+	}
+	if username != "" {
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return sender, nil
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	from, err := mail.ParseAddress(s.from)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	body, err := msg.Bytes(s.from, time.Now())
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(s.addr, s.auth, from.Address, []string{to.Address}, body)
+}
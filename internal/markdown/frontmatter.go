@@ -0,0 +1,113 @@
+package markdown
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidFrontMatter = errors.New("Invalid front matter")
+
+// FrontMatter holds the post fields carried in the YAML block at the top of
+// an imported file. Only flat "key: value" pairs are understood, which is all
+// the post fields need.
+type FrontMatter struct {
+	Title       string
+	Slug        string
+	Description string
+	Image       string
+}
+
+// SplitFrontMatter separates the front matter from the Markdown body. A
+// file without a leading "---" line has no front matter.
+func SplitFrontMatter(source string) (FrontMatter, string, error) {
+	var matter FrontMatter
+
+	source = normalizeNewlines(source)
+	source = strings.TrimPrefix(source, "\ufeff")
+	if !strings.HasPrefix(source, "---\n") {
+		return matter, source, nil
+	}
+
+	lines := strings.Split(source, "\n")
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if line := strings.TrimRight(lines[i], " \t"); line == "---" || line == "..." {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return matter, "", fmt.Errorf("%w: missing closing ---", ErrInvalidFrontMatter)
+	}
+
+	for i, line := range lines[1:end] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return matter, "", fmt.Errorf("%w: line %d", ErrInvalidFrontMatter, i+2)
+		}
+		value, err := unquote(strings.TrimSpace(value))
+		if err != nil {
+			return matter, "", fmt.Errorf("%w: line %d", ErrInvalidFrontMatter, i+2)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "title":
+			matter.Title = value
+		case "slug":
+			matter.Slug = value
+		case "description":
+			matter.Description = value
+		case "image":
+			matter.Image = value
+		}
+	}
+
+	return matter, strings.Join(lines[end+1:], "\n"), nil
+}
+
+// String writes the front matter block, quoting every value so titles with
+// colons or leading symbols survive a round trip.
+func (f FrontMatter) String() string {
+	var builder strings.Builder
+	builder.WriteString("---\n")
+	for _, field := range [][2]string{
+		{"title", f.Title},
+		{"slug", f.Slug},
+		{"description", f.Description},
+		{"image", f.Image},
+	} {
+		if field[1] == "" {
+			continue
+		}
+		fmt.Fprintf(&builder, "%v: %v\n", field[0], strconv.Quote(field[1]))
+	}
+	builder.WriteString("---\n")
+
+	return builder.String()
+}
+
+func unquote(value string) (string, error) {
+	switch {
+	case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+		return strconv.Unquote(value)
+	case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+
+	// plain scalars may carry a trailing comment
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+func normalizeNewlines(source string) string {
+	return strings.ReplaceAll(source, "\r\n", "\n")
+}
@@ -0,0 +1,219 @@
+package markdown
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mznrasil/my-blogs-be/internal/document"
+)
+
+// TestRoundTrip writes each document as Markdown and parses it back, which
+// must give the same document. The documents use the attrs Parse produces.
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{
+			name: "paragraphs",
+			doc: `{"type": "doc", "content": [
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "First line"},
+					{"type": "hardBreak"},
+					{"type": "text", "text": "second line"}
+				]},
+				{"type": "paragraph"},
+				{"type": "horizontalRule"},
+				{"type": "paragraph", "content": [{"type": "text", "text": "after the rule"}]}
+			]}`,
+		},
+		{
+			name: "escapes",
+			doc: `{"type": "doc", "content": [
+				{"type": "paragraph", "content": [{"type": "text", "text": "# not a heading"}]},
+				{"type": "paragraph", "content": [{"type": "text", "text": "1. not a list"}]},
+				{"type": "paragraph", "content": [{"type": "text", "text": "- not a bullet"}]},
+				{"type": "paragraph", "content": [{"type": "text", "text": "> not a quote"}]},
+				{"type": "paragraph", "content": [{"type": "text", "text": "<br>"}]},
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "*stars* _underscores_ ~~tildes~~ [brackets] a \\ b"}
+				]},
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "a < b, <u>not underlined</u> and <a href=\"x\">no link</a>"}
+				]},
+				{"type": "paragraph", "content": [{"type": "text", "text": "snake_case_name"}]}
+			]}`,
+		},
+		{
+			name: "headings",
+			doc: `{"type": "doc", "content": [
+				{"type": "heading", "attrs": {"level": 1}, "content": [{"type": "text", "text": "One"}]},
+				{"type": "heading", "attrs": {"level": 2}, "content": [
+					{"type": "text", "text": "Two "},
+					{"type": "text", "text": "bold", "marks": [{"type": "bold"}]}
+				]},
+				{"type": "heading", "attrs": {"level": 6}, "content": [{"type": "text", "text": "Six"}]}
+			]}`,
+		},
+		{
+			name: "lists",
+			doc: `{"type": "doc", "content": [
+				{"type": "bulletList", "content": [
+					{"type": "listItem", "content": [
+						{"type": "paragraph", "content": [{"type": "text", "text": "One"}]}
+					]},
+					{"type": "listItem", "content": [
+						{"type": "paragraph", "content": [{"type": "text", "text": "Two"}]},
+						{"type": "orderedList", "attrs": {"start": 1}, "content": [
+							{"type": "listItem", "content": [
+								{"type": "paragraph", "content": [{"type": "text", "text": "Nested"}]}
+							]}
+						]}
+					]}
+				]},
+				{"type": "bulletList", "content": [
+					{"type": "listItem", "content": [
+						{"type": "paragraph", "content": [{"type": "text", "text": "Separate list"}]}
+					]}
+				]},
+				{"type": "orderedList", "attrs": {"start": 3}, "content": [
+					{"type": "listItem", "content": [
+						{"type": "paragraph", "content": [{"type": "text", "text": "Third"}]}
+					]},
+					{"type": "listItem", "content": [
+						{"type": "paragraph", "content": [{"type": "text", "text": "Fourth"}]},
+						{"type": "paragraph", "content": [{"type": "text", "text": "More"}]}
+					]}
+				]}
+			]}`,
+		},
+		{
+			name: "code",
+			doc: `{"type": "doc", "content": [
+				{"type": "codeBlock", "attrs": {"language": "go"}, "content": [
+					{"type": "text", "text": "func main() {\n\tfmt.Println(\"` + "```" + `\")\n}"}
+				]},
+				{"type": "codeBlock", "attrs": {"language": null}, "content": [
+					{"type": "text", "text": "# not a heading\n*not bold*"}
+				]},
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "call "},
+					{"type": "text", "text": "a` + "`" + `b", "marks": [{"type": "code"}]},
+					{"type": "text", "text": " and "},
+					{"type": "text", "text": "<u>", "marks": [{"type": "code"}]}
+				]}
+			]}`,
+		},
+		{
+			name: "blockquote",
+			doc: `{"type": "doc", "content": [
+				{"type": "blockquote", "content": [
+					{"type": "paragraph", "content": [{"type": "text", "text": "Quoted"}]},
+					{"type": "bulletList", "content": [
+						{"type": "listItem", "content": [
+							{"type": "paragraph", "content": [{"type": "text", "text": "item"}]}
+						]}
+					]}
+				]}
+			]}`,
+		},
+		{
+			name: "images",
+			doc: `{"type": "doc", "content": [
+				{"type": "image", "attrs": {"src": "https://example.com/cat.png", "alt": "A [cat]", "title": "Say \"hi\""}},
+				{"type": "image", "attrs": {"src": "/media/my cat (1).png", "alt": null, "title": null}}
+			]}`,
+		},
+		{
+			name: "links",
+			doc: `{"type": "doc", "content": [
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "plain", "marks": [
+						{"type": "link", "attrs": {"href": "https://example.com/a_b"}}
+					]},
+					{"type": "text", "text": " "},
+					{"type": "text", "text": "titled", "marks": [
+						{"type": "link", "attrs": {"href": "https://example.com", "title": "Example"}}
+					]},
+					{"type": "text", "text": " "},
+					{"type": "text", "text": "new tab", "marks": [
+						{"type": "link", "attrs": {"href": "https://example.com/?a=1&b=\"2\"", "target": "_blank"}}
+					]},
+					{"type": "text", "text": " "},
+					{"type": "text", "text": "both", "marks": [
+						{"type": "link", "attrs": {"href": "/about", "title": "<About & us>", "target": "_top"}}
+					]}
+				]},
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "in ", "marks": [{"type": "italic"}]},
+					{"type": "text", "text": "a_b", "marks": [
+						{"type": "link", "attrs": {"href": "https://example.com/*x*", "target": "_blank"}},
+						{"type": "italic"}
+					]},
+					{"type": "text", "text": " italics", "marks": [{"type": "italic"}]}
+				]}
+			]}`,
+		},
+		{
+			name: "marks",
+			doc: `{"type": "doc", "content": [
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "bold", "marks": [{"type": "bold"}]},
+					{"type": "text", "text": " "},
+					{"type": "text", "text": "italic", "marks": [{"type": "italic"}]},
+					{"type": "text", "text": " "},
+					{"type": "text", "text": "strike", "marks": [{"type": "strike"}]},
+					{"type": "text", "text": " "},
+					{"type": "text", "text": "underline", "marks": [{"type": "underline"}]},
+					{"type": "text", "text": " H"},
+					{"type": "text", "text": "2", "marks": [{"type": "subscript"}]},
+					{"type": "text", "text": "O x"},
+					{"type": "text", "text": "2", "marks": [{"type": "superscript"}]},
+					{"type": "text", "text": " "},
+					{"type": "text", "text": "code", "marks": [{"type": "code"}]}
+				]},
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "all ", "marks": [{"type": "bold"}]},
+					{"type": "text", "text": "of", "marks": [
+						{"type": "link", "attrs": {"href": "https://example.com"}},
+						{"type": "bold"},
+						{"type": "italic"},
+						{"type": "underline"}
+					]},
+					{"type": "text", "text": " them", "marks": [{"type": "bold"}]},
+					{"type": "text", "text": "un", "marks": [{"type": "underline"}]},
+					{"type": "text", "text": "der", "marks": [{"type": "italic"}, {"type": "underline"}]},
+					{"type": "text", "text": "line", "marks": [{"type": "underline"}]}
+				]},
+				{"type": "paragraph", "content": [
+					{"type": "text", "text": "line", "marks": [{"type": "underline"}]},
+					{"type": "hardBreak"},
+					{"type": "text", "text": "break", "marks": [{"type": "underline"}]}
+				]}
+			]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := document.Decode(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			written := Write(doc)
+			got, err := json.Marshal(Parse(written))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != string(want) {
+				t.Errorf("round trip mismatch\nmarkdown:\n%v\ngot:  %s\nwant: %s", written, got, want)
+			}
+		})
+	}
+}
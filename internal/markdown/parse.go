@@ -0,0 +1,774 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mznrasil/my-blogs-be/internal/document"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?[ \t]*$`)
+	rulePattern        = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fencePattern       = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`\\s]*)[ \t]*$")
+	bulletPattern      = regexp.MustCompile(`^([-+*])([ \t]+|$)`)
+	orderedPattern     = regexp.MustCompile(`^(\d{1,9})([.)])([ \t]+|$)`)
+	imagePattern       = regexp.MustCompile(`^!\[((?:\\.|[^\]\\])*)\]\(\s*(<[^>]*>|[^\s)]+)(?:\s+"((?:\\.|[^"\\])*)")?\s*\)$`)
+	htmlOpenPattern    = regexp.MustCompile(`^<(u|sub|sup)>|^<a((?:\s+[a-z]+="[^"]*")*)\s*>`)
+	htmlTagPattern     = regexp.MustCompile(`^</(?:u|sub|sup|a)>|^<(?:u|sub|sup)>|^<a(?:\s+[a-z]+="[^"]*")*\s*>`)
+	htmlAttrPattern    = regexp.MustCompile(`([a-z]+)="([^"]*)"`)
+	emptyParagraph     = "<br>"
+	listSeparator      = "<!-- -->"
+	punctuationEscapes = "\\`*_{}[]()<>#+-.!|~\"'"
+)
+
+// Parse converts Markdown into an editor document. Front matter must be
+// removed with SplitFrontMatter first.
+func Parse(source string) document.Node {
+	lines := strings.Split(normalizeNewlines(source), "\n")
+	return document.Node{Type: "doc", Content: parseBlocks(lines)}
+}
+
+func parseBlocks(lines []string) []document.Node {
+	var blocks []document.Node
+
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		if isBlank(line) || strings.TrimSpace(line) == listSeparator {
+			i++
+			continue
+		}
+
+		var block document.Node
+		switch {
+		case fencePattern.MatchString(line):
+			block, i = parseCodeBlock(lines, i)
+		case headingPattern.MatchString(line):
+			match := headingPattern.FindStringSubmatch(line)
+			block = document.Node{
+				Type:    "heading",
+				Attrs:   map[string]any{"level": len(match[1])},
+				Content: parseInline(match[2]),
+			}
+			i++
+		case rulePattern.MatchString(line):
+			block = document.Node{Type: "horizontalRule"}
+			i++
+		case strings.HasPrefix(line, ">"):
+			block, i = parseBlockquote(lines, i)
+		case bulletPattern.MatchString(line), orderedPattern.MatchString(line):
+			block, i = parseList(lines, i)
+		case imagePattern.MatchString(line):
+			block = parseImage(line)
+			i++
+		case strings.TrimSpace(line) == emptyParagraph:
+			block = document.Node{Type: "paragraph"}
+			i++
+		default:
+			block, i = parseParagraph(lines, i)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks
+}
+
+func parseCodeBlock(lines []string, start int) (document.Node, int) {
+	match := fencePattern.FindStringSubmatch(lines[start])
+	fence := match[1]
+
+	var language any
+	if match[2] != "" {
+		language = match[2]
+	}
+
+	var code []string
+	i := start + 1
+	for ; i < len(lines); i++ {
+		closing := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == "" {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+
+	block := document.Node{Type: "codeBlock", Attrs: map[string]any{"language": language}}
+	if text := strings.Join(code, "\n"); text != "" {
+		block.Content = []document.Node{{Type: "text", Text: text}}
+	}
+
+	return block, i
+}
+
+func parseBlockquote(lines []string, start int) (document.Node, int) {
+	var inner []string
+	i := start
+	for ; i < len(lines) && strings.HasPrefix(lines[i], ">"); i++ {
+		line := strings.TrimPrefix(lines[i], ">")
+		inner = append(inner, strings.TrimPrefix(line, " "))
+	}
+
+	return document.Node{Type: "blockquote", Content: parseBlocks(inner)}, i
+}
+
+// listMarker reports the marker at the start of a list line and how far its
+// content is indented, which is how far continuation lines must be indented.
+func listMarker(line string) (ordered bool, start int, delimiter string, width int, ok bool) {
+	if rulePattern.MatchString(line) {
+		return false, 0, "", 0, false
+	}
+
+	if match := bulletPattern.FindStringSubmatch(line); match != nil {
+		return false, 0, match[1], markerWidth(match[1], match[2]), true
+	}
+	if match := orderedPattern.FindStringSubmatch(line); match != nil {
+		start, _ = strconv.Atoi(match[1])
+		return true, start, match[2], markerWidth(match[1]+match[2], match[3]), true
+	}
+
+	return false, 0, "", 0, false
+}
+
+func markerWidth(marker, spacing string) int {
+	if spacing == "" || len(spacing) > 4 {
+		return len(marker) + 1
+	}
+
+	return len(marker) + len(spacing)
+}
+
+func parseList(lines []string, start int) (document.Node, int) {
+	ordered, first, delimiter, _, _ := listMarker(lines[start])
+
+	list := document.Node{Type: "bulletList"}
+	if ordered {
+		list = document.Node{Type: "orderedList", Attrs: map[string]any{"start": first}}
+	}
+
+	i := start
+	for i < len(lines) {
+		itemOrdered, _, itemDelimiter, width, ok := listMarker(lines[i])
+		if !ok || itemOrdered != ordered || itemDelimiter != delimiter {
+			break
+		}
+
+		content := []string{""}
+		if width < len(lines[i]) {
+			content[0] = lines[i][width:]
+		}
+		i++
+
+	item:
+		for ; i < len(lines); i++ {
+			line := lines[i]
+			switch {
+			case isBlank(line):
+				next := nextNonBlank(lines, i)
+				if next < 0 || indentation(lines[next]) < width {
+					break item
+				}
+				content = append(content, "")
+			case indentation(line) >= width:
+				content = append(content, line[width:])
+			case isLazyContinuation(content, line):
+				content = append(content, line)
+			default:
+				break item
+			}
+		}
+
+		list.Content = append(list.Content, document.Node{
+			Type:    "listItem",
+			Content: parseBlocks(content),
+		})
+
+		// a blank line between items keeps the list going
+		if i < len(lines) && isBlank(lines[i]) {
+			next := nextNonBlank(lines, i)
+			if next < 0 {
+				i = len(lines)
+				break
+			}
+			nextOrdered, _, nextDelimiter, _, ok := listMarker(lines[next])
+			if !ok || nextOrdered != ordered || nextDelimiter != delimiter {
+				break
+			}
+			i = next
+		}
+	}
+
+	return list, i
+}
+
+// isLazyContinuation lets an unindented line continue the paragraph that
+// ends the current list item, as long as it does not start a new block.
+func isLazyContinuation(content []string, line string) bool {
+	if len(content) == 0 || isBlank(content[len(content)-1]) {
+		return false
+	}
+
+	return !startsBlock(line)
+}
+
+func parseImage(line string) document.Node {
+	match := imagePattern.FindStringSubmatch(line)
+
+	attrs := map[string]any{
+		"src":   unescape(strings.TrimSuffix(strings.TrimPrefix(match[2], "<"), ">")),
+		"alt":   nil,
+		"title": nil,
+	}
+	if match[1] != "" {
+		attrs["alt"] = unescape(match[1])
+	}
+	if match[3] != "" {
+		attrs["title"] = unescape(match[3])
+	}
+
+	return document.Node{Type: "image", Attrs: attrs}
+}
+
+func parseParagraph(lines []string, start int) (document.Node, int) {
+	var text strings.Builder
+	i := start
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if i > start && (isBlank(line) || startsBlock(line)) {
+			break
+		}
+
+		if i > start {
+			previous := lines[i-1]
+			if endsWithHardBreak(previous) {
+				text.WriteString("\n")
+			} else {
+				text.WriteString(" ")
+			}
+		}
+
+		if i+1 < len(lines) && !isBlank(lines[i+1]) && !startsBlock(lines[i+1]) &&
+			endsWithHardBreak(line) {
+			if strings.HasSuffix(line, "  ") {
+				line = strings.TrimRight(line, " ")
+			} else {
+				line = line[:len(line)-1]
+			}
+		}
+		text.WriteString(line)
+	}
+
+	return document.Node{Type: "paragraph", Content: parseInline(text.String())}, i
+}
+
+func startsBlock(line string) bool {
+	if fencePattern.MatchString(line) || headingPattern.MatchString(line) ||
+		rulePattern.MatchString(line) || strings.HasPrefix(line, ">") ||
+		imagePattern.MatchString(line) || strings.TrimSpace(line) == listSeparator {
+		return true
+	}
+
+	_, _, _, _, ok := listMarker(line)
+	return ok
+}
+
+// endsWithHardBreak matches both hard break spellings: a trailing backslash
+// that is not itself escaped, or two trailing spaces.
+func endsWithHardBreak(line string) bool {
+	if strings.HasSuffix(line, "  ") {
+		return true
+	}
+
+	backslashes := len(line) - len(strings.TrimRight(line, "\\"))
+	return backslashes%2 == 1
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func nextNonBlank(lines []string, from int) int {
+	for i := from; i < len(lines); i++ {
+		if !isBlank(lines[i]) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func unescape(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) && isEscapable(value[i+1]) {
+			i++
+		}
+		builder.WriteByte(value[i])
+	}
+
+	return builder.String()
+}
+
+func isEscapable(c byte) bool {
+	return strings.IndexByte(punctuationEscapes, c) >= 0
+}
+
+// parseInline turns paragraph text into text nodes with marks. A newline in
+// the text stands for a hard break.
+func parseInline(text string) []document.Node {
+	nodes := parseSpan(text, nil)
+	for i := range nodes {
+		sortMarks(nodes[i].Marks)
+	}
+
+	return mergeText(nodes)
+}
+
+func parseSpan(text string, marks []document.Mark) []document.Node {
+	var nodes []document.Node
+	var buffer strings.Builder
+	flush := func() {
+		if buffer.Len() > 0 {
+			nodes = append(nodes, textNode(buffer.String(), marks))
+			buffer.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text) && isEscapable(text[i+1]):
+			buffer.WriteByte(text[i+1])
+			i += 2
+		case c == '\n':
+			flush()
+			nodes = append(nodes, document.Node{Type: "hardBreak"})
+			i++
+		case c == '`':
+			run := runLength(text, i)
+			end := codeSpanEnd(text, i)
+			if end < 0 {
+				buffer.WriteString(text[i : i+run])
+				i += run
+				continue
+			}
+			flush()
+			code := text[i+run : end-run]
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' &&
+				strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			nodes = append(nodes, textNode(code, withMark(marks, document.Mark{Type: "code"})))
+			i = end
+		case c == '<':
+			mark, inner, end, ok := parseHTMLMark(text, i)
+			if !ok {
+				buffer.WriteByte(c)
+				i++
+				continue
+			}
+			flush()
+			nodes = append(nodes, parseSpan(inner, withMark(marks, mark))...)
+			i = end
+		case c == '[':
+			label, href, title, end, ok := parseLink(text, i)
+			if !ok {
+				buffer.WriteByte(c)
+				i++
+				continue
+			}
+			flush()
+			attrs := map[string]any{"href": href}
+			if title != "" {
+				attrs["title"] = title
+			}
+			link := document.Mark{Type: "link", Attrs: attrs}
+			nodes = append(nodes, parseSpan(label, withMark(marks, link))...)
+			i = end
+		case c == '*' || c == '_' || c == '~':
+			delimiter, markType := emphasis(text, i)
+			if delimiter == "" {
+				buffer.WriteByte(c)
+				i++
+				continue
+			}
+			end := findCloser(text, i+len(delimiter), delimiter)
+			if end < 0 {
+				buffer.WriteByte(c)
+				i++
+				continue
+			}
+			flush()
+			inner := text[i+len(delimiter) : end]
+			nodes = append(
+				nodes,
+				parseSpan(inner, withMark(marks, document.Mark{Type: markType}))...,
+			)
+			i = end + len(delimiter)
+		default:
+			buffer.WriteByte(c)
+			i++
+		}
+	}
+	flush()
+
+	return nodes
+}
+
+// emphasis picks the delimiter opening at i. Underscores inside a word are
+// plain text so snake_case identifiers survive, and a lone delimiter between
+// spaces is never emphasis.
+func emphasis(text string, i int) (string, string) {
+	c := text[i]
+	run := runLength(text, i)
+
+	if c == '_' && i > 0 && isWordChar(text[i-1]) {
+		return "", ""
+	}
+	if i+run >= len(text) || text[i+run] == ' ' && (i == 0 || text[i-1] == ' ') {
+		return "", ""
+	}
+
+	switch {
+	case c == '~' && run >= 2:
+		return "~~", "strike"
+	case c == '~':
+		return "", ""
+	case run >= 2:
+		return strings.Repeat(string(c), 2), "bold"
+	default:
+		return string(c), "italic"
+	}
+}
+
+// findCloser looks for the delimiter that closes an emphasis span opened
+// just before from, stepping over escapes, code spans and nested spans that
+// use the same character.
+func findCloser(text string, from int, delimiter string) int {
+	c := delimiter[0]
+	for k := from; k < len(text); {
+		switch text[k] {
+		case '\\':
+			k += 2
+			continue
+		case '`':
+			if end := codeSpanEnd(text, k); end > 0 {
+				k = end
+				continue
+			}
+			k += runLength(text, k)
+			continue
+		case '<':
+			// attribute values are no delimiters
+			if tag := htmlTagPattern.FindString(text[k:]); tag != "" {
+				k += len(tag)
+				continue
+			}
+		}
+
+		if text[k] != c {
+			k++
+			continue
+		}
+
+		run := runLength(text, k)
+		if k == from || c == '_' && k+run < len(text) && isWordChar(text[k+run]) {
+			k += run
+			continue
+		}
+
+		switch {
+		case run == len(delimiter):
+			return k
+		case run > len(delimiter) && len(delimiter) == 2:
+			// in ***a*** the inner span takes the first delimiter, in
+			// **a***b* the closing run also opens the next span
+			if k+run < len(text) && isWordChar(text[k+run]) {
+				return k
+			}
+			return k + run - 2
+		case c == '~':
+			k += run
+		case run > len(delimiter):
+			if text[k-1] != ' ' {
+				return k
+			}
+			// a double delimiter after a space opens a nested span
+			if end := findCloser(text, k+2, delimiter+delimiter); end >= 0 {
+				k = end + 2
+				continue
+			}
+			return k
+		default:
+			if end := findCloser(text, k+1, delimiter[:1]); end >= 0 {
+				k = end + 1
+				continue
+			}
+			k++
+		}
+	}
+
+	return -1
+}
+
+func codeSpanEnd(text string, start int) int {
+	run := runLength(text, start)
+	for k := start + run; k < len(text); {
+		if text[k] != '`' {
+			k++
+			continue
+		}
+		closing := runLength(text, k)
+		if closing == run {
+			return k + closing
+		}
+		k += closing
+	}
+
+	return -1
+}
+
+// htmlMarkTypes maps the inline HTML tags Write uses for marks Markdown has no
+// syntax for back onto those marks.
+var htmlMarkTypes = map[string]string{"u": "underline", "sub": "subscript", "sup": "superscript"}
+
+// parseHTMLMark reads one of the inline HTML elements Write produces,
+// starting at its opening tag. Any other HTML stays text.
+func parseHTMLMark(text string, start int) (document.Mark, string, int, bool) {
+	match := htmlOpenPattern.FindStringSubmatch(text[start:])
+	if match == nil {
+		return document.Mark{}, "", 0, false
+	}
+
+	tag := match[1]
+	mark := document.Mark{Type: htmlMarkTypes[tag]}
+	if tag == "" {
+		tag = "a"
+		attrs := map[string]any{}
+		for _, attr := range htmlAttrPattern.FindAllStringSubmatch(match[2], -1) {
+			switch attr[1] {
+			case "href", "title", "target":
+				attrs[attr[1]] = html.UnescapeString(attr[2])
+			}
+		}
+		if _, ok := attrs["href"]; !ok {
+			return document.Mark{}, "", 0, false
+		}
+		mark = document.Mark{Type: "link", Attrs: attrs}
+	}
+
+	from := start + len(match[0])
+	end := htmlCloser(text, from, tag)
+	if end < 0 {
+		return document.Mark{}, "", 0, false
+	}
+
+	return mark, text[from:end], end + len("</"+tag+">"), true
+}
+
+// htmlCloser finds the closing tag of an element opened just before from,
+// stepping over escapes, code spans and nested elements of the same tag.
+func htmlCloser(text string, from int, tag string) int {
+	closing := "</" + tag + ">"
+	depth := 0
+	for k := from; k < len(text); {
+		switch {
+		case text[k] == '\\':
+			k += 2
+		case text[k] == '`':
+			if end := codeSpanEnd(text, k); end > 0 {
+				k = end
+			} else {
+				k += runLength(text, k)
+			}
+		case strings.HasPrefix(text[k:], closing):
+			if depth == 0 {
+				return k
+			}
+			depth--
+			k += len(closing)
+		case text[k] == '<':
+			match := htmlOpenPattern.FindStringSubmatch(text[k:])
+			if match != nil && (match[1] == tag || match[1] == "" && tag == "a") {
+				depth++
+				k += len(match[0])
+			} else {
+				k++
+			}
+		default:
+			k++
+		}
+	}
+
+	return -1
+}
+
+// parseLink reads [label](href "title") starting at the opening bracket.
+func parseLink(text string, start int) (string, string, string, int, bool) {
+	depth := 0
+	labelEnd := -1
+	for k := start; k < len(text) && labelEnd < 0; k++ {
+		switch text[k] {
+		case '\\':
+			k++
+		case '`':
+			if end := codeSpanEnd(text, k); end > 0 {
+				k = end - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				labelEnd = k
+			}
+		}
+	}
+	if labelEnd < 0 || labelEnd+1 >= len(text) || text[labelEnd+1] != '(' {
+		return "", "", "", 0, false
+	}
+
+	k := labelEnd + 2
+	var href string
+	if k < len(text) && text[k] == '<' {
+		end := strings.IndexByte(text[k:], '>')
+		if end < 0 {
+			return "", "", "", 0, false
+		}
+		href = text[k+1 : k+end]
+		k += end + 1
+	} else {
+		hrefStart, parens := k, 0
+		for ; k < len(text); k++ {
+			if text[k] == '\\' {
+				k++
+				continue
+			}
+			if text[k] == ' ' || text[k] == ')' && parens == 0 {
+				break
+			}
+			if text[k] == '(' {
+				parens++
+			} else if text[k] == ')' {
+				parens--
+			}
+		}
+		href = text[hrefStart:min(k, len(text))]
+	}
+
+	for k < len(text) && text[k] == ' ' {
+		k++
+	}
+	var title string
+	if k < len(text) && text[k] == '"' {
+		titleStart := k + 1
+		for k = titleStart; k < len(text) && text[k] != '"'; k++ {
+			if text[k] == '\\' {
+				k++
+			}
+		}
+		if k >= len(text) {
+			return "", "", "", 0, false
+		}
+		title = unescape(text[titleStart:k])
+		k++
+		for k < len(text) && text[k] == ' ' {
+			k++
+		}
+	}
+	if k >= len(text) || text[k] != ')' {
+		return "", "", "", 0, false
+	}
+
+	return text[start+1 : labelEnd], unescape(href), title, k + 1, true
+}
+
+func runLength(text string, start int) int {
+	end := start
+	for end < len(text) && text[end] == text[start] {
+		end++
+	}
+
+	return end - start
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func textNode(text string, marks []document.Mark) document.Node {
+	return document.Node{Type: "text", Text: text, Marks: marks}
+}
+
+func withMark(marks []document.Mark, mark document.Mark) []document.Mark {
+	for _, existing := range marks {
+		if existing.Type == mark.Type {
+			return marks
+		}
+	}
+
+	return append(append([]document.Mark{}, marks...), mark)
+}
+
+// markRank fixes the order of marks on a text node. The writer nests marks in
+// this order too, so a document keeps its marks through a round trip.
+var markRank = map[string]int{
+	"link":        0,
+	"bold":        1,
+	"italic":      2,
+	"strike":      3,
+	"underline":   4,
+	"subscript":   5,
+	"superscript": 6,
+	"code":        7,
+}
+
+func sortMarks(marks []document.Mark) {
+	sort.SliceStable(marks, func(i, j int) bool {
+		return markRank[marks[i].Type] < markRank[marks[j].Type]
+	})
+}
+
+func mergeText(nodes []document.Node) []document.Node {
+	var merged []document.Node
+	for _, node := range nodes {
+		if node.Type == "text" && node.Text == "" {
+			continue
+		}
+		last := len(merged) - 1
+		if last >= 0 && node.Type == "text" && merged[last].Type == "text" &&
+			sameMarks(merged[last].Marks, node.Marks) {
+			merged[last].Text += node.Text
+			continue
+		}
+		merged = append(merged, node)
+	}
+
+	return merged
+}
+
+func sameMarks(a, b []document.Mark) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameMark(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func sameMark(a, b document.Mark) bool {
+	return a.Type == b.Type && a.StringAttr("href") == b.StringAttr("href") &&
+		a.StringAttr("title") == b.StringAttr("title") &&
+		a.StringAttr("target") == b.StringAttr("target")
+}
@@ -0,0 +1,326 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/mznrasil/my-blogs-be/internal/document"
+)
+
+var (
+	orderedStart = regexp.MustCompile(`^(\d+)([.)])`)
+	textEscapes  = strings.NewReplacer(
+		`\`, `\\`,
+		"`", "\\`",
+		`*`, `\*`,
+		`_`, `\_`,
+		`~`, `\~`,
+		`[`, `\[`,
+		`]`, `\]`,
+		`<`, `\<`,
+	)
+)
+
+// Write converts an editor document into Markdown. Every node type Parse
+// understands is written so that parsing the output gives the document back.
+// Underline, subscript, superscript and links with a target have no Markdown
+// syntax and are written as the inline HTML tags Parse reads back. Nodes it
+// does not know keep their text, marks it does not know are dropped.
+func Write(root document.Node) string {
+	return strings.TrimSuffix(writeBlocks(root.Content), "\n") + "\n"
+}
+
+func writeBlocks(blocks []document.Node) string {
+	var builder strings.Builder
+	for i, block := range blocks {
+		if i > 0 {
+			builder.WriteString("\n\n")
+			// two lists of the same kind in a row would merge into one
+			if isList(block) && blocks[i-1].Type == block.Type {
+				builder.WriteString(listSeparator + "\n\n")
+			}
+		}
+		builder.WriteString(writeBlock(block))
+	}
+
+	return builder.String()
+}
+
+func writeBlock(n document.Node) string {
+	switch n.Type {
+	case "paragraph":
+		if len(n.Content) == 0 {
+			return emptyParagraph
+		}
+		return escapeLineStarts(writeInline(n.Content))
+	case "heading":
+		level := min(max(n.IntAttr("level", 1), 1), 6)
+		return strings.Repeat("#", level) + " " + writeInline(n.Content)
+	case "blockquote":
+		return prefixLines(writeBlocks(n.Content), "> ", ">")
+	case "bulletList", "orderedList":
+		return writeList(n)
+	case "codeBlock":
+		return writeCodeBlock(n)
+	case "image":
+		return writeImage(n)
+	case "horizontalRule":
+		return "---"
+	}
+
+	if len(n.Content) > 0 && n.Content[0].Type == "text" {
+		return escapeLineStarts(writeInline(n.Content))
+	}
+	return writeBlocks(n.Content)
+}
+
+func writeList(list document.Node) string {
+	start := list.IntAttr("start", 1)
+
+	var builder strings.Builder
+	for i, item := range list.Content {
+		marker := "-"
+		if list.Type == "orderedList" {
+			marker = fmt.Sprintf("%d.", start+i)
+		}
+		indent := strings.Repeat(" ", len(marker)+1)
+
+		var body strings.Builder
+		for j, block := range item.Content {
+			if j > 0 {
+				// nested lists hug the paragraph they belong to
+				if isList(block) && !isList(item.Content[j-1]) {
+					body.WriteString("\n")
+				} else {
+					body.WriteString("\n\n")
+				}
+			}
+			body.WriteString(writeBlock(block))
+		}
+
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		builder.WriteString(marker + " " + prefixLines(body.String(), indent, "")[len(indent):])
+	}
+
+	return builder.String()
+}
+
+func writeCodeBlock(n document.Node) string {
+	var code strings.Builder
+	for _, child := range n.Content {
+		code.WriteString(child.Text)
+	}
+
+	fence := "```"
+	for strings.Contains(code.String(), fence) {
+		fence += "`"
+	}
+
+	return fence + n.StringAttr("language") + "\n" + code.String() + "\n" + fence
+}
+
+func writeImage(n document.Node) string {
+	image := fmt.Sprintf(
+		"![%v](%v",
+		textEscapes.Replace(n.StringAttr("alt")),
+		destination(n.StringAttr("src")),
+	)
+	if title := n.StringAttr("title"); title != "" {
+		image += ` "` + escapeTitle(title) + `"`
+	}
+
+	return image + ")"
+}
+
+type span struct {
+	text      string
+	hardBreak bool
+	marks     []document.Mark
+}
+
+// writeInline nests marks in markRank order, so bold text with an italic
+// word inside is written as **a _b_ c** rather than three separate spans.
+func writeInline(nodes []document.Node) string {
+	spans := make([]span, 0, len(nodes))
+	for _, n := range nodes {
+		switch n.Type {
+		case "hardBreak":
+			spans = append(spans, span{hardBreak: true})
+		case "text":
+			spans = append(spans, span{text: n.Text, marks: supportedMarks(n.Marks)})
+		}
+	}
+
+	var builder strings.Builder
+	writeSpans(&builder, spans)
+	return builder.String()
+}
+
+func writeSpans(b *strings.Builder, spans []span) {
+	for i := 0; i < len(spans); {
+		current := spans[i]
+		switch {
+		case current.hardBreak:
+			b.WriteString("\\\n")
+			i++
+			continue
+		case len(current.marks) == 0:
+			b.WriteString(textEscapes.Replace(current.text))
+			i++
+			continue
+		case current.marks[0].Type == "code":
+			b.WriteString(codeSpan(current.text))
+			i++
+			continue
+		}
+
+		mark := current.marks[0]
+		end := i + 1
+		for end < len(spans) && len(spans[end].marks) > 0 && sameMark(spans[end].marks[0], mark) {
+			end++
+		}
+
+		inner := make([]span, 0, end-i)
+		for _, s := range spans[i:end] {
+			inner = append(inner, span{text: s.text, marks: s.marks[1:]})
+		}
+
+		opening, closing := markDelimiters(mark)
+		// underscores do not open or close emphasis inside a word
+		if mark.Type == "italic" && (endsWithWordChar(b) || startsWithWordChar(spans[end:])) {
+			opening, closing = "*", "*"
+		}
+		b.WriteString(opening)
+		writeSpans(b, inner)
+		b.WriteString(closing)
+		i = end
+	}
+}
+
+func endsWithWordChar(b *strings.Builder) bool {
+	written := b.String()
+	return written != "" && isWordChar(written[len(written)-1])
+}
+
+func startsWithWordChar(spans []span) bool {
+	return len(spans) > 0 && !spans[0].hardBreak && len(spans[0].marks) == 0 &&
+		spans[0].text != "" && isWordChar(spans[0].text[0])
+}
+
+func supportedMarks(marks []document.Mark) []document.Mark {
+	supported := make([]document.Mark, 0, len(marks))
+	for _, mark := range marks {
+		if _, ok := markRank[mark.Type]; ok {
+			supported = append(supported, mark)
+		}
+	}
+	sortMarks(supported)
+
+	return supported
+}
+
+func markDelimiters(mark document.Mark) (string, string) {
+	switch mark.Type {
+	case "link":
+		if mark.StringAttr("target") != "" {
+			return htmlLink(mark), "</a>"
+		}
+		link := "](" + destination(mark.StringAttr("href"))
+		if title := mark.StringAttr("title"); title != "" {
+			link += ` "` + escapeTitle(title) + `"`
+		}
+		return "[", link + ")"
+	case "bold":
+		return "**", "**"
+	case "italic":
+		return "_", "_"
+	case "strike":
+		return "~~", "~~"
+	case "underline", "subscript", "superscript":
+		tag := htmlMarkTags[mark.Type]
+		return "<" + tag + ">", "</" + tag + ">"
+	}
+
+	return "", ""
+}
+
+// htmlMarkTags are the inline HTML tags written for marks Markdown has no
+// syntax for.
+var htmlMarkTags = map[string]string{"underline": "u", "subscript": "sub", "superscript": "sup"}
+
+func htmlLink(mark document.Mark) string {
+	link := `<a href="` + html.EscapeString(mark.StringAttr("href")) + `"`
+	if title := mark.StringAttr("title"); title != "" {
+		link += ` title="` + html.EscapeString(title) + `"`
+	}
+
+	return link + ` target="` + html.EscapeString(mark.StringAttr("target")) + `">`
+}
+
+func escapeTitle(title string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(title, `\`, `\\`), `"`, `\"`)
+}
+
+func codeSpan(text string) string {
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") ||
+		strings.HasPrefix(text, " ") && strings.HasSuffix(text, " ") {
+		return fence + " " + text + " " + fence
+	}
+
+	return fence + text + fence
+}
+
+// destination wraps URLs that contain spaces or unbalanced parentheses in
+// angle brackets so the link syntax stays unambiguous.
+func destination(url string) string {
+	if strings.ContainsAny(url, " ()<>") {
+		return "<" + url + ">"
+	}
+
+	return url
+}
+
+// escapeLineStarts keeps paragraph text that happens to look like a block
+// marker from being read back as a heading, quote, list or image.
+func escapeLineStarts(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case line == "":
+		case strings.ContainsRune("#>-+!", rune(line[0])):
+			lines[i] = `\` + line
+		case strings.HasPrefix(line, emptyParagraph), strings.HasPrefix(line, listSeparator):
+			lines[i] = `\` + line
+		case orderedStart.MatchString(line):
+			match := orderedStart.FindStringSubmatch(line)
+			lines[i] = match[1] + `\` + line[len(match[1]):]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func prefixLines(text, prefix, emptyPrefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = emptyPrefix
+			continue
+		}
+		lines[i] = prefix + line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func isList(n document.Node) bool {
+	return n.Type == "bulletList" || n.Type == "orderedList"
+}
@@ -0,0 +1,107 @@
+package mergepatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+var ErrInvalidPatch = errors.New("Patch must be a JSON object")
+
+// MaxSize bounds patch documents. Posts carry their whole editor document, so
+// this leaves room for long articles.
+const MaxSize = 4 << 20
+
+// Read reads a patch from the request body.
+func Read(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, MaxSize))
+}
+
+// Apply applies a JSON Merge Patch (RFC 7396) to the JSON encoding of
+// target and decodes the result into dst. Members set to null in the patch
+// are removed, objects are merged recursively and everything else replaces
+// the value in target.
+func Apply(target any, patch []byte, dst any) error {
+	var patchValue any
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return err
+	}
+	// a patch that is not an object would replace the whole resource
+	if _, ok := patchValue.(map[string]any); !ok {
+		return ErrInvalidPatch
+	}
+
+	marshalledTarget, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	var targetValue any
+	if err = json.Unmarshal(marshalledTarget, &targetValue); err != nil {
+		return err
+	}
+
+	merged, err := json.Marshal(merge(targetValue, patchValue))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(merged, dst)
+}
+
+// Fields lists the top-level members a patch sets, including those set to
+// null.
+func Fields(patch []byte) (map[string]bool, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]bool, len(members))
+	for name := range members {
+		fields[name] = true
+	}
+
+	return fields, nil
+}
+
+// RequireFields fails when the patch sets one of the named top-level members
+// to null. Null removes a member, which blanks a required field rather than
+// leaving it alone.
+func RequireFields(patch []byte, names ...string) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil {
+		return ErrInvalidPatch
+	}
+
+	for _, name := range names {
+		if value, ok := members[name]; ok && bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			return fmt.Errorf("%v cannot be removed", name)
+		}
+	}
+
+	return nil
+}
+
+func merge(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = merge(targetObject[name], value)
+	}
+
+	return targetObject
+}
@@ -21,6 +21,41 @@ func WithAuth(next http.Handler) http.Handler {
 	})
 }
 
+// WithOptionalAuth identifies the reader like WithAuth when X-User-Id is
+// present, but lets anonymous requests through.
+func WithOptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Header.Get("X-User-Id")
+		if userId == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "userID", userId)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithAdmin lets only the users in userIDs through. It goes after WithAuth.
+func WithAdmin(userIDs []string) func(http.Handler) http.Handler {
+	admins := map[string]bool{}
+	for _, userID := range userIDs {
+		admins[userID] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value("userID").(string)
+			if !admins[userID] {
+				helpers.WriteJSONError(w, http.StatusForbidden, "Forbidden")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Do stuff here
@@ -2,6 +2,10 @@ package models
 
 import (
 	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/cache"
+	"github.com/mznrasil/my-blogs-be/internal/diff"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
 )
 
 type Payment struct {
@@ -116,14 +120,16 @@ type UserStore interface {
 }
 
 type Site struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Description  string    `json:"description"`
-	Subdirectory string    `json:"subdirectory"`
-	ImageUrl     string    `json:"image_url"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	UserID       string    `json:"user_id"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Description  string     `json:"description"`
+	Subdirectory string     `json:"subdirectory"`
+	ImageUrl     string     `json:"image_url"`
+	ImageSet     *ImageSet  `json:"image_set,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+	UserID       string     `json:"user_id"`
 }
 
 type SiteName struct {
@@ -136,6 +142,15 @@ type SiteSubdirectory struct {
 	Subdirectory string `json:"subdirectory"`
 }
 
+// SiteVersion sums up what the public pages of a site are built from. Its Tag
+// changes whenever any of them would, so it can validate cached copies
+// without building them. LastModified is the latest change to any of them.
+type SiteVersion struct {
+	SiteID       string
+	LastModified time.Time
+	Tag          string
+}
+
 type SitePosts struct {
 	Site  SiteName `json:"site"`
 	Posts []Post   `json:"posts"`
@@ -148,56 +163,508 @@ type CreateSitePayload struct {
 	ImageUrl     string `json:"image_url"`
 }
 
+type UpdateSitePayload struct {
+	Name         string `json:"name"         validate:"required,max=35"`
+	Description  string `json:"description"  validate:"max=150"`
+	Subdirectory string `json:"subdirectory" validate:"required,max=40"`
+	ImageUrl     string `json:"image_url"`
+}
+
+// SiteRedirectStore finds where sites that changed their subdirectory went.
+type SiteRedirectStore interface {
+	GetCurrentSubdirectory(subdirectory string) (string, error)
+}
+
 type SiteStore interface {
 	CreateSite(newSite CreateSitePayload, userID string) error
 	GetSiteByID(siteID string) (*Site, error)
 	GetSiteBySubdirectory(subdirectory string) (*Site, error)
-	GetAllSitesByUserId(userID string, take int) ([]Site, error)
-	UpdateSiteImage(siteID, userID, imageUrl string) error
+	GetAllSitesByUserId(userID string, page pagination.Params) ([]Site, pagination.Page, error)
+	UpdateSite(siteID, userID string, site UpdateSitePayload) error
 	DeleteSite(siteID, userID string) error
+	GetTrashedSites(userID string, page pagination.Params) ([]Site, pagination.Page, error)
+	RestoreSite(siteID, userID string) error
+	IsSubdirectoryTaken(subdirectory, siteID string) (bool, error)
+	GetCurrentSubdirectory(subdirectory string) (string, error)
+	GetSitemapChunks(siteID string, size int) ([]time.Time, error)
+	GetSitemapEntries(siteID string, offset, limit int) ([]SitemapEntry, error)
+}
+
+// SiteCache drops what is cached of a site's public content.
+type SiteCache interface {
+	InvalidateSite(siteID string)
+}
+
+type SitemapEntry struct {
+	Slug      string    `json:"slug"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	PostStatusDraft     = "draft"
+	PostStatusPublished = "published"
+	PostStatusScheduled = "scheduled"
+	PostStatusArchived  = "archived"
+)
+
+type Tag struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	SiteID    string    `json:"site_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateTagPayload struct {
+	Name string `json:"name" validate:"required,max=50"`
+}
+
+type TagStore interface {
+	GetTagsBySiteID(siteID, userID string) ([]Tag, error)
+	GetTagBySlug(slug, siteID string) (*Tag, error)
+	CreateTag(newTag CreateTagPayload, siteID, userID string) (*Tag, error)
+	UpdateTag(tag CreateTagPayload, tagID, siteID, userID string) error
+	DeleteTag(tagID, siteID, userID string) error
+}
+
+type Category struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	SiteID      string    `json:"site_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CreateCategoryPayload struct {
+	Name        string `json:"name"        validate:"required,max=50"`
+	Description string `json:"description" validate:"max=150"`
+}
+
+type CategoryStore interface {
+	GetCategoriesBySiteID(siteID, userID string) ([]Category, error)
+	GetCategoryBySlug(slug, siteID string) (*Category, error)
+	CreateCategory(newCategory CreateCategoryPayload, siteID, userID string) (*Category, error)
+	UpdateCategory(category CreateCategoryPayload, categoryID, siteID, userID string) error
+	DeleteCategory(categoryID, siteID, userID string) error
+}
+
+type Topic struct {
+	Name      string `json:"name"`
+	Slug      string `json:"slug"`
+	PostCount int    `json:"post_count,omitempty"`
+}
+
+type TopicPosts struct {
+	Site  SiteName `json:"site"`
+	Topic Topic    `json:"topic"`
+	Posts []Post   `json:"posts"`
 }
 
 type CreatePostPayload struct {
-	Title            string `json:"title"`
-	ArticleContent   any    `json:"article_content"`
-	SmallDescription string `json:"small_description"`
-	Image            string `json:"image"`
-	Slug             string `json:"slug"`
+	Title            string   `json:"title"`
+	ArticleContent   any      `json:"article_content"`
+	SmallDescription string   `json:"small_description"`
+	Image            string   `json:"image"`
+	Slug             string   `json:"slug"`
+	Tags             []string `json:"tags"              validate:"omitempty,max=20,dive,required,max=50"`
+	CategoryID       *string  `json:"category_id"`
+	MembersOnly      bool     `json:"members_only"`
 }
 
 type Post struct {
+	ID               string     `json:"id"`
+	Title            string     `json:"title"`
+	ArticleContent   any        `json:"article_content"`
+	ContentHTML      string     `json:"content_html,omitempty"`
+	SmallDescription string     `json:"small_description"`
+	Image            string     `json:"image"`
+	ImageSet         *ImageSet  `json:"image_set,omitempty"`
+	Slug             string     `json:"slug"`
+	Status           string     `json:"status"`
+	PublishedAt      *time.Time `json:"published_at"`
+	Tags             []Topic    `json:"tags,omitempty"`
+	CategoryID       *string    `json:"category_id"`
+	Category         *Topic     `json:"category,omitempty"`
+	WordCount        int        `json:"word_count"`
+	ReadingTime      int        `json:"reading_time"`
+	TableOfContents  []Heading  `json:"table_of_contents,omitempty"`
+	Version          int        `json:"version"`
+	MembersOnly      bool       `json:"members_only"`
+	Truncated        bool       `json:"truncated,omitempty"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	UserID           string     `json:"user_id"`
+	SiteID           string     `json:"site_id"`
+}
+
+// Heading is one entry of a post's table of contents. ID is the anchor the
+// rendered heading carries.
+type Heading struct {
+	ID    string `json:"id"`
+	Text  string `json:"text"`
+	Level int    `json:"level"`
+}
+
+type PublishPostPayload struct {
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+type PublishEvent struct {
+	PostID       string    `json:"post_id"`
+	SiteID       string    `json:"site_id"`
+	ScheduledFor time.Time `json:"scheduled_for"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error"`
+}
+
+type PostSummary struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	Image       string     `json:"image"`
+	Status      string     `json:"status"`
+	PublishedAt *time.Time `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type PostSite struct {
+	Posts []PostSummary    `json:"posts"`
+	Site  SiteSubdirectory `json:"site"`
+}
+
+type PostSearchResult struct {
 	ID               string    `json:"id"`
 	Title            string    `json:"title"`
-	ArticleContent   any       `json:"article_content"`
 	SmallDescription string    `json:"small_description"`
 	Image            string    `json:"image"`
 	Slug             string    `json:"slug"`
+	Status           string    `json:"status"`
 	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
-	UserID           string    `json:"user_id"`
 	SiteID           string    `json:"site_id"`
+	Headline         string    `json:"headline"`
+	Snippet          string    `json:"snippet"`
+	Rank             float64   `json:"rank"`
+	MembersOnly      bool      `json:"members_only"`
 }
 
-type PostSummary struct {
-	ID        string    `json:"id"`
-	Title     string    `json:"title"`
-	Image     string    `json:"image"`
-	CreatedAt time.Time `json:"created_at"`
+type PostRevision struct {
+	ID               string    `json:"id"`
+	PostID           string    `json:"post_id"`
+	RevisionNumber   int       `json:"revision_number"`
+	Title            string    `json:"title"`
+	ArticleContent   any       `json:"article_content"`
+	SmallDescription string    `json:"small_description"`
+	Image            string    `json:"image"`
+	Slug             string    `json:"slug"`
+	UserID           string    `json:"user_id"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
-type PostSite struct {
-	Posts []PostSummary    `json:"posts"`
-	Site  SiteSubdirectory `json:"site"`
+type PostRevisionSummary struct {
+	ID             string    `json:"id"`
+	RevisionNumber int       `json:"revision_number"`
+	Title          string    `json:"title"`
+	UserID         string    `json:"user_id"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type PostRevisionDiff struct {
+	From    PostRevisionSummary  `json:"from"`
+	To      *PostRevisionSummary `json:"to"`
+	Changes []diff.Change        `json:"changes"`
+}
+
+// PostPreview is a link to a post that works without an account, whatever
+// the post's status. Token is only known when the preview is created.
+type PostPreview struct {
+	ID        string     `json:"id"`
+	PostID    string     `json:"post_id"`
+	Token     string     `json:"token,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	MaxViews  int        `json:"max_views"`
+	ViewCount int        `json:"view_count"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type CreatePostPreviewPayload struct {
+	ExpiresInHours int `json:"expires_in_hours" validate:"omitempty,min=1,max=720"`
+	MaxViews       int `json:"max_views"        validate:"omitempty,min=1,max=1000"`
 }
 
 type PostStore interface {
-	GetAllPostsByUserID(userID string, take int) ([]Post, error)
-	GetAllPostsByUserIDAndSiteID(userID, siteID string) (*PostSite, error)
+	GetAllPostsByUserID(userID string, page pagination.Params) ([]Post, pagination.Page, error)
+	GetAllPostsByUserIDAndSiteID(
+		userID, siteID string,
+		page pagination.Params,
+	) (*PostSite, pagination.Page, error)
 	CreatePost(newPost CreatePostPayload, userID, siteID string) error
 	GetPostBySlug(slug, userID, siteID string) (*Post, error)
 	GetPostByID(postID, siteID, userID string) (*Post, error)
-	EditPost(post CreatePostPayload, postID, userID, siteID string) error
+	EditPost(post CreatePostPayload, postID, userID, siteID string, version int) error
 	DeletePost(postID, siteID, userID string) error
-	GetAllSitePostsBySubdirectory(subdirectory string) (*SitePosts, error)
+	GetTrashedPosts(siteID, userID string, page pagination.Params) ([]Post, pagination.Page, error)
+	RestorePost(postID, siteID, userID string) error
+	IsPostSlugTaken(slug, siteID, postID string) (bool, error)
+	GetAllSitePostsBySubdirectory(
+		subdirectory string,
+		page pagination.Params,
+	) (*SitePosts, pagination.Page, error)
+	GetSiteVersion(subdirectory string) (*SiteVersion, error)
 	GetAllSitePostsBySlug(subdirectory, slug string) (*Post, error)
+	GetCurrentSitePostSlug(subdirectory, slug string) (string, error)
+	GenerateUniquePostSlug(title, siteID string) (string, error)
+	UpdatePostStatus(postID, siteID, userID, status string, publishedAt *time.Time) error
+	GetPostRevisions(postID, siteID, userID string) ([]PostRevisionSummary, error)
+	GetPostRevision(revisionID, postID, siteID, userID string) (*PostRevision, error)
+	RestorePostRevision(revisionID, postID, siteID, userID string, version int) error
+	CreatePostPreview(
+		postID, siteID, userID string,
+		expiresAt time.Time,
+		maxViews int,
+	) (*PostPreview, error)
+	GetPostPreviews(postID, siteID, userID string) ([]PostPreview, error)
+	RevokePostPreview(previewID, postID, siteID, userID string) error
+	UsePostPreview(previewID string) (*Post, error)
+	SearchPostsByUserID(userID, query string, limit int) ([]PostSearchResult, error)
+	SearchSitePosts(
+		subdirectory, query string,
+		limit int,
+		readerID string,
+		subscribed bool,
+	) ([]PostSearchResult, error)
+	GetSiteTags(subdirectory string) ([]Topic, error)
+	GetSiteCategories(subdirectory string) ([]Topic, error)
+	GetSitePostsByTag(
+		subdirectory, tag string,
+		page pagination.Params,
+	) (*TopicPosts, pagination.Page, error)
+	GetSitePostsByCategory(
+		subdirectory, category string,
+		page pagination.Params,
+	) (*TopicPosts, pagination.Page, error)
+}
+
+// CacheStatsReporter is implemented by stores that keep a read cache, keyed
+// by the name of each cache.
+type CacheStatsReporter interface {
+	Stats() map[string]cache.Stats
+}
+
+// TrashStore is implemented by stores that soft delete their rows.
+type TrashStore interface {
+	PurgeTrash(before time.Time) (int64, error)
+}
+
+type PostScheduleStore interface {
+	PublishDuePosts(now time.Time, limit int) ([]PublishEvent, error)
+}
+
+const (
+	CommentStatusPending  = "pending"
+	CommentStatusApproved = "approved"
+	CommentStatusRejected = "rejected"
+	CommentStatusSpam     = "spam"
+)
+
+type Comment struct {
+	ID          string    `json:"id"`
+	PostID      string    `json:"post_id"`
+	PostTitle   string    `json:"post_title,omitempty"`
+	ParentID    *string   `json:"parent_id"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email,omitempty"`
+	Body        string    `json:"body"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Replies     []Comment `json:"replies,omitempty"`
+}
+
+type CreateCommentPayload struct {
+	ParentID    *string `json:"parent_id"`
+	AuthorName  string  `json:"author_name"  validate:"required,max=50"`
+	AuthorEmail string  `json:"author_email" validate:"required,email,max=255"`
+	Body        string  `json:"body"         validate:"required,max=5000"`
+}
+
+type CommentStore interface {
+	CreateComment(subdirectory, slug string, comment CreateCommentPayload) (*Comment, error)
+	GetPostComments(subdirectory, slug string) ([]Comment, error)
+	GetSiteComments(
+		siteID, userID, status string,
+		page pagination.Params,
+	) ([]Comment, pagination.Page, error)
+	UpdateCommentStatus(commentID, siteID, userID, status string) error
+	DeleteComment(commentID, siteID, userID string) error
+}
+
+// PageView is what the beacon knows about a reader. The store only keeps a
+// salted hash of it.
+type PageView struct {
+	IP        string
+	UserAgent string
+	Referrer  string
+}
+
+type DailyViews struct {
+	Day            string `json:"day"`
+	Views          int    `json:"views"`
+	UniqueVisitors int    `json:"unique_visitors"`
+}
+
+// ViewsReport totals the views of a date range. Visitor hashes are salted per
+// day, so visitors cannot be told apart across days: VisitorDays sums the
+// daily unique visitors and counts a reader once for every day they came.
+type ViewsReport struct {
+	Views       int          `json:"views"`
+	VisitorDays int          `json:"visitor_days"`
+	Days        []DailyViews `json:"days"`
+}
+
+type ReferrerViews struct {
+	Referrer string `json:"referrer"`
+	Views    int    `json:"views"`
+}
+
+type AnalyticsStore interface {
+	RecordView(subdirectory, slug string, view PageView) error
+	GetPostViews(postID, siteID, userID string, from, to time.Time) (*ViewsReport, error)
+	GetSiteViews(siteID, userID string, from, to time.Time) (*ViewsReport, error)
+	GetTopReferrers(
+		siteID, userID string,
+		postID *string,
+		from, to time.Time,
+		limit int,
+	) ([]ReferrerViews, error)
+}
+
+const (
+	SubscriberStatusPending      = "pending"
+	SubscriberStatusConfirmed    = "confirmed"
+	SubscriberStatusUnsubscribed = "unsubscribed"
+)
+
+type Subscriber struct {
+	ID             string     `json:"id"`
+	SiteID         string     `json:"site_id"`
+	Email          string     `json:"email"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ConfirmedAt    *time.Time `json:"confirmed_at"`
+	UnsubscribedAt *time.Time `json:"unsubscribed_at"`
+}
+
+type CreateSubscriberPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// SubscriberConfirmation is what the double opt-in mail needs to reach a new
+// subscriber.
+type SubscriberConfirmation struct {
+	Email    string
+	SiteName string
+	Token    string
+}
+
+type SubscriberStore interface {
+	CreateSubscriber(subdirectory, email string) (*SubscriberConfirmation, error)
+	GetConfirmationSiteName(token string) (string, error)
+	ConfirmSubscriber(token string) (*Subscriber, error)
+	ReleaseConfirmation(token string) error
+	GetUnsubscribeSiteName(token string) (string, error)
+	Unsubscribe(token string) error
+	GetSubscribers(
+		siteID, userID, status string,
+		page pagination.Params,
+	) ([]Subscriber, pagination.Page, error)
+	GetAllSubscribers(siteID, userID string) ([]Subscriber, error)
+}
+
+// NewsletterDelivery is one published post still to be mailed to one
+// confirmed subscriber.
+type NewsletterDelivery struct {
+	PostID           string
+	Title            string
+	SmallDescription string
+	Slug             string
+	ArticleContent   any
+	MembersOnly      bool
+	SiteName         string
+	Subdirectory     string
+	SubscriberID     string
+	Email            string
+	UnsubscribeToken string
+}
+
+type NewsletterStore interface {
+	GetPendingDeliveries(since time.Time, limit int) ([]NewsletterDelivery, error)
+	ClaimDelivery(postID, subscriberID string) (bool, error)
+	FailDelivery(postID, subscriberID, reason string) (bool, error)
+}
+
+type Media struct {
+	ID         string         `json:"id"`
+	UserID     string         `json:"user_id"`
+	SiteID     string         `json:"site_id"`
+	Filename   string         `json:"filename"`
+	MimeType   string         `json:"mime_type"`
+	Size       int64          `json:"size"`
+	Checksum   string         `json:"checksum"`
+	Width      *int           `json:"width,omitempty"`
+	Height     *int           `json:"height,omitempty"`
+	StorageKey string         `json:"-"`
+	URL        string         `json:"url"`
+	Variants   []MediaVariant `json:"variants,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+type MediaUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"`
+}
+
+type MediaStore interface {
+	CreateMedia(media Media) error
+	GetMediaBySiteID(
+		siteID, userID string,
+		page pagination.Params,
+	) ([]Media, pagination.Page, error)
+	GetMediaByID(mediaID string) (*Media, error)
+	DeleteMedia(mediaID, siteID, userID string) (*Media, error)
+	GetMediaUsage(userID string) (*MediaUsage, error)
+	CreateMediaVariant(variant MediaVariant) error
+	GetMediaVariant(mediaID, name string) (*MediaVariant, error)
+}
+
+// ImageSet describes an uploaded image and its resized variants: one source
+// per type, WebP first, as <picture> expects them.
+type ImageSet struct {
+	Src     string        `json:"src"`
+	Width   int           `json:"width"`
+	Height  int           `json:"height"`
+	Sources []ImageSource `json:"sources"`
+}
+
+type ImageSource struct {
+	Type   string `json:"type"`
+	SrcSet string `json:"srcset"`
+}
+
+type MediaVariant struct {
+	ID         string    `json:"-"`
+	MediaID    string    `json:"-"`
+	Name       string    `json:"name"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	MimeType   string    `json:"mime_type"`
+	Size       int64     `json:"size"`
+	StorageKey string    `json:"-"`
+	OnDemand   bool      `json:"-"`
+	URL        string    `json:"url"`
+	CreatedAt  time.Time `json:"-"`
 }
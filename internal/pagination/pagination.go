@@ -0,0 +1,121 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("Invalid cursor")
+
+// Cursor is the (created_at, id) position of the last row on a page. Lists
+// are ordered newest first, so the next page holds every row sorting below it.
+type Cursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+type Params struct {
+	Limit int
+	After *Cursor
+}
+
+type Page struct {
+	NextCursor string
+	HasMore    bool
+}
+
+func Encode(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func Decode(value string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	cursor := new(Cursor)
+	if err := json.Unmarshal(data, cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// FromRequest reads ?limit= and ?cursor=. The older ?take= parameter is still
+// accepted as an alias for limit.
+func FromRequest(r *http.Request) (Params, error) {
+	params := Params{Limit: DefaultLimit}
+
+	limitParam := r.URL.Query().Get("limit")
+	if limitParam == "" {
+		limitParam = r.URL.Query().Get("take")
+	}
+	if limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			return params, errors.New("Limit must be a positive integer")
+		}
+		params.Limit = min(limit, MaxLimit)
+	}
+
+	if cursorParam := r.URL.Query().Get("cursor"); cursorParam != "" {
+		cursor, err := Decode(cursorParam)
+		if err != nil {
+			return params, err
+		}
+		params.After = cursor
+	}
+
+	return params, nil
+}
+
+// Clause returns the keyset condition and ordering for a query whose
+// existing placeholders are already in args. One extra row is requested so
+// Trim can tell whether another page exists.
+func (p Params) Clause(createdAtColumn, idColumn string, args []any) (string, []any) {
+	var clause string
+	if p.After != nil {
+		args = append(args, p.After.CreatedAt, p.After.ID)
+		clause = fmt.Sprintf(
+			" AND (%v, %v) < ($%d, $%d)",
+			createdAtColumn,
+			idColumn,
+			len(args)-1,
+			len(args),
+		)
+	}
+
+	args = append(args, p.Limit+1)
+	clause += fmt.Sprintf(
+		" ORDER BY %v DESC, %v DESC LIMIT $%d",
+		createdAtColumn,
+		idColumn,
+		len(args),
+	)
+
+	return clause, args
+}
+
+func Trim[T any](items []T, p Params, cursorOf func(T) Cursor) ([]T, Page) {
+	if len(items) <= p.Limit {
+		return items, Page{}
+	}
+
+	items = items[:p.Limit]
+	return items, Page{
+		NextCursor: Encode(cursorOf(items[len(items)-1])),
+		HasMore:    true,
+	}
+}
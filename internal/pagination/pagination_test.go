@@ -0,0 +1,81 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeRoundTrips(t *testing.T) {
+	cursor := Cursor{
+		CreatedAt: time.Date(2024, 10, 30, 12, 0, 0, 123456789, time.UTC),
+		ID:        "0192dd2e-6a4c-7d2b-9b1e-1f0c2a3b4c5d",
+	}
+
+	got, err := Decode(Encode(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(cursor.CreatedAt) || got.ID != cursor.ID {
+		t.Errorf("Decode(Encode(%+v)) = %+v", cursor, *got)
+	}
+}
+
+func TestDecodeRejectsInvalidCursors(t *testing.T) {
+	for _, value := range []string{
+		"not base64!",
+		base64.RawURLEncoding.EncodeToString([]byte("not json")),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"c":"2024-10-30T12:00:00Z"}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"c":"yesterday","i":"a"}`)),
+	} {
+		if _, err := Decode(value); err != ErrInvalidCursor {
+			t.Errorf("Decode(%q) error = %v, want %v", value, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestClauseFirstPage(t *testing.T) {
+	clause, args := Params{Limit: 20}.Clause("p.created_at", "p.id", []any{"site"})
+
+	want := " ORDER BY p.created_at DESC, p.id DESC LIMIT $2"
+	if clause != want {
+		t.Errorf("Clause() = %q, want %q", clause, want)
+	}
+	if !reflect.DeepEqual(args, []any{"site", 21}) {
+		t.Errorf("Clause() args = %v, want [site 21]", args)
+	}
+}
+
+func TestClauseAfterCursor(t *testing.T) {
+	after := &Cursor{CreatedAt: time.Date(2024, 10, 30, 0, 0, 0, 0, time.UTC), ID: "a"}
+	clause, args := Params{Limit: 5, After: after}.Clause("created_at", "id", []any{"site"})
+
+	want := " AND (created_at, id) < ($2, $3) ORDER BY created_at DESC, id DESC LIMIT $4"
+	if clause != want {
+		t.Errorf("Clause() = %q, want %q", clause, want)
+	}
+	if !reflect.DeepEqual(args, []any{"site", after.CreatedAt, "a", 6}) {
+		t.Errorf("Clause() args = %v", args)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	createdAt := time.Date(2024, 10, 30, 0, 0, 0, 0, time.UTC)
+	cursorOf := func(id string) Cursor {
+		return Cursor{CreatedAt: createdAt, ID: id}
+	}
+
+	items, page := Trim([]string{"a", "b"}, Params{Limit: 2}, cursorOf)
+	if len(items) != 2 || page.HasMore || page.NextCursor != "" {
+		t.Errorf("Trim() of a full last page = %v, %+v, want both items and no more", items, page)
+	}
+
+	items, page = Trim([]string{"a", "b", "c"}, Params{Limit: 2}, cursorOf)
+	if !reflect.DeepEqual(items, []string{"a", "b"}) || !page.HasMore {
+		t.Errorf("Trim() of an extra row = %v, %+v, want [a b] and more", items, page)
+	}
+	if page.NextCursor != Encode(cursorOf("b")) {
+		t.Errorf("Trim() cursor = %q, want the cursor of b", page.NextCursor)
+	}
+}
@@ -0,0 +1,82 @@
+package preview
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNoSecret     = errors.New("Preview links are not configured")
+	ErrInvalidToken = errors.New("Invalid preview token")
+	ErrExpiredToken = errors.New("Preview link has expired")
+)
+
+// Enabled reports whether a signing secret is configured.
+func Enabled() bool {
+	return os.Getenv("PREVIEW_TOKEN_SECRET") != ""
+}
+
+// Sign mints the token for a preview. The preview id and its expiry are
+// signed with PREVIEW_TOKEN_SECRET, so tokens cannot be guessed and the same
+// preview always gets the same token.
+func Sign(id string, expiresAt time.Time) (string, error) {
+	secret := os.Getenv("PREVIEW_TOKEN_SECRET")
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+
+	payload := id + "." + strconv.FormatInt(expiresAt.Unix(), 10)
+	return encode(payload) + "." + encode(string(signature(secret, payload))), nil
+}
+
+// Verify checks a token's signature and expiry and returns the preview id.
+// Revocation and view limits are up to the caller.
+func Verify(token string, now time.Time) (string, error) {
+	secret := os.Getenv("PREVIEW_TOKEN_SECRET")
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(sig, signature(secret, string(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	id, expiry, ok := strings.Cut(string(payload), ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	if !now.Before(time.Unix(expiresAt, 0)) {
+		return "", ErrExpiredToken
+	}
+
+	return id, nil
+}
+
+func signature(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func encode(value string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
@@ -0,0 +1,172 @@
+// Package render turns the rich-text editor's JSON documents into HTML.
+//
+// Only known node types and marks produce tags, every text and attribute
+// value is escaped and URLs are restricted to safe schemes, so the output
+// can be embedded in a page as is.
+package render
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/mznrasil/my-blogs-be/internal/document"
+)
+
+// HTML renders an editor document. Anything that is not an editor document
+// renders as an empty string.
+func HTML(value any) string {
+	root, err := document.Decode(value)
+	if err != nil {
+		return ""
+	}
+
+	var builder strings.Builder
+	renderNode(&builder, anchors{}, root)
+	return builder.String()
+}
+
+func renderNode(b *strings.Builder, ids anchors, n document.Node) {
+	switch n.Type {
+	case "text":
+		renderText(b, n)
+	case "paragraph":
+		wrap(b, ids, "p", n)
+	case "heading":
+		level := min(max(n.IntAttr("level", 1), 1), 6)
+		fmt.Fprintf(b, `<h%d id="%v">`, level, html.EscapeString(ids.id(plainText(n))))
+		renderChildren(b, ids, n)
+		fmt.Fprintf(b, "</h%d>", level)
+	case "blockquote":
+		wrap(b, ids, "blockquote", n)
+	case "bulletList":
+		wrap(b, ids, "ul", n)
+	case "orderedList":
+		if start := n.IntAttr("start", 1); start != 1 {
+			fmt.Fprintf(b, `<ol start="%d">`, start)
+		} else {
+			b.WriteString("<ol>")
+		}
+		renderChildren(b, ids, n)
+		b.WriteString("</ol>")
+	case "listItem":
+		wrap(b, ids, "li", n)
+	case "codeBlock":
+		b.WriteString("<pre><code")
+		if language := n.StringAttr("language"); language != "" {
+			fmt.Fprintf(b, ` class="language-%v"`, html.EscapeString(language))
+		}
+		b.WriteString(">")
+		for _, child := range n.Content {
+			b.WriteString(html.EscapeString(child.Text))
+		}
+		b.WriteString("</code></pre>")
+	case "image":
+		renderImage(b, n)
+	case "horizontalRule":
+		b.WriteString("<hr>")
+	case "hardBreak":
+		b.WriteString("<br>")
+	default:
+		// the document root and node types we do not know keep their
+		// content so an editor upgrade never loses text
+		renderChildren(b, ids, n)
+	}
+}
+
+func wrap(b *strings.Builder, ids anchors, tag string, n document.Node) {
+	b.WriteString("<" + tag + ">")
+	renderChildren(b, ids, n)
+	b.WriteString("</" + tag + ">")
+}
+
+func renderChildren(b *strings.Builder, ids anchors, n document.Node) {
+	for _, child := range n.Content {
+		renderNode(b, ids, child)
+	}
+}
+
+func renderImage(b *strings.Builder, n document.Node) {
+	src, ok := safeURL(n.StringAttr("src"))
+	if !ok {
+		return
+	}
+
+	fmt.Fprintf(b, `<img src="%v" alt="%v"`, html.EscapeString(src),
+		html.EscapeString(n.StringAttr("alt")))
+	if title := n.StringAttr("title"); title != "" {
+		fmt.Fprintf(b, ` title="%v"`, html.EscapeString(title))
+	}
+	b.WriteString(">")
+}
+
+func renderText(b *strings.Builder, n document.Node) {
+	var closing []string
+	for _, m := range n.Marks {
+		open, close := markTags(m)
+		if open == "" {
+			continue
+		}
+		b.WriteString(open)
+		closing = append(closing, close)
+	}
+
+	b.WriteString(html.EscapeString(n.Text))
+
+	for i := len(closing) - 1; i >= 0; i-- {
+		b.WriteString(closing[i])
+	}
+}
+
+func markTags(m document.Mark) (string, string) {
+	switch m.Type {
+	case "bold":
+		return "<strong>", "</strong>"
+	case "italic":
+		return "<em>", "</em>"
+	case "underline":
+		return "<u>", "</u>"
+	case "strike":
+		return "<s>", "</s>"
+	case "code":
+		return "<code>", "</code>"
+	case "subscript":
+		return "<sub>", "</sub>"
+	case "superscript":
+		return "<sup>", "</sup>"
+	case "link":
+		href, ok := safeURL(m.StringAttr("href"))
+		if !ok {
+			return "", ""
+		}
+		open := fmt.Sprintf(`<a href="%v"`, html.EscapeString(href))
+		if m.StringAttr("target") == "_blank" {
+			open += ` target="_blank" rel="noopener noreferrer nofollow"`
+		}
+		return open + ">", "</a>"
+	}
+
+	return "", ""
+}
+
+// safeURL only lets through web, mail and relative URLs, which rules out
+// javascript: and data: payloads smuggled into links or images.
+func safeURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", false
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https", "mailto":
+		return raw, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestHTML renders testdata/<name>.json and compares the result with
+// testdata/<name>.html. Run with -update after an intended change to the
+// output and review the diff of the golden files.
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name string
+	}{
+		{name: "paragraphs"},
+		{name: "headings"},
+		{name: "lists"},
+		{name: "code"},
+		{name: "images"},
+		{name: "links"},
+		{name: "marks"},
+		{name: "hostile"},
+		{name: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join("testdata", tt.name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := HTML(json.RawMessage(input))
+
+			golden := filepath.Join("testdata", tt.name+".html")
+			if *update {
+				if err = os.WriteFile(golden, []byte(got+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got+"\n" != string(want) {
+				t.Errorf("HTML() mismatch\ngot:  %v\nwant: %v", got, string(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mznrasil/my-blogs-be/internal/document"
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+// wordsPerMinute is a common estimate for reading on screen.
+const wordsPerMinute = 200
+
+type Stats struct {
+	WordCount       int
+	ReadingTime     int
+	TableOfContents []models.Heading
+}
+
+// Analyze counts the words of a document and lists its headings. Heading ids
+// are the same ones HTML puts on the rendered headings, so the table of
+// contents can link straight to them.
+func Analyze(value any) Stats {
+	stats := Stats{TableOfContents: []models.Heading{}}
+
+	root, err := document.Decode(value)
+	if err != nil {
+		return stats
+	}
+
+	stats.WordCount = len(strings.Fields(plainText(root)))
+	if stats.WordCount > 0 {
+		stats.ReadingTime = (stats.WordCount + wordsPerMinute - 1) / wordsPerMinute
+	}
+
+	ids := anchors{}
+	var walk func(n document.Node)
+	walk = func(n document.Node) {
+		if n.Type == "heading" {
+			text := plainText(n)
+			stats.TableOfContents = append(stats.TableOfContents, models.Heading{
+				ID:    ids.id(text),
+				Text:  text,
+				Level: min(max(n.IntAttr("level", 1), 1), 6),
+			})
+			return
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	return stats
+}
+
+// anchors hands out heading ids that are unique within one document.
+type anchors map[string]bool
+
+func (a anchors) id(text string) string {
+	base := helpers.Slugify(text)
+	if base == "" {
+		base = "section"
+	}
+
+	id := base
+	for n := 2; a[id]; n++ {
+		id = fmt.Sprintf("%v-%d", base, n)
+	}
+	a[id] = true
+
+	return id
+}
+
+// plainText joins the text of a node, keeping words in neighbouring blocks
+// apart while text nodes inside one block run together.
+func plainText(n document.Node) string {
+	var builder strings.Builder
+	var collect func(n document.Node)
+	collect = func(n document.Node) {
+		switch n.Type {
+		case "text":
+			builder.WriteString(n.Text)
+		case "hardBreak":
+			builder.WriteString(" ")
+		default:
+			for _, child := range n.Content {
+				collect(child)
+			}
+			builder.WriteString(" ")
+		}
+	}
+	collect(n)
+
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
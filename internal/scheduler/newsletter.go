@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/document"
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/mail"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/render"
+)
+
+type Newsletter struct {
+	store    models.NewsletterStore
+	sender   mail.Sender
+	interval time.Duration
+	window   time.Duration
+	apiURL   string
+}
+
+// NewNewsletter mails posts published within the last window to the site's
+// subscribers. apiURL is where the API routes are mounted, for the
+// unsubscribe links. Posts published from the API and by the scheduler are
+// picked up alike.
+func NewNewsletter(
+	store models.NewsletterStore,
+	sender mail.Sender,
+	interval, window time.Duration,
+	apiURL string,
+) *Newsletter {
+	return &Newsletter{
+		store:    store,
+		sender:   sender,
+		interval: interval,
+		window:   window,
+		apiURL:   apiURL,
+	}
+}
+
+// Run sends pending newsletters every interval until ctx is cancelled.
+func (n *Newsletter) Run(ctx context.Context) {
+	log.Println("Newsletter started, interval", n.interval, "window", n.window)
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		n.deliver(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Newsletter stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (n *Newsletter) deliver(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := n.store.GetPendingDeliveries(time.Now().Add(-n.window), batchSize)
+		if err != nil {
+			log.Println("Failed to load newsletter deliveries:", err)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			claimed, err := n.store.ClaimDelivery(delivery.PostID, delivery.SubscriberID)
+			if err != nil {
+				log.Printf("Failed to claim newsletter for post %v: %v", delivery.PostID, err)
+				return
+			}
+			if !claimed {
+				continue
+			}
+
+			if err = n.sender.Send(n.message(delivery)); err != nil {
+				log.Printf("Failed to send post %v to %v: %v", delivery.PostID, delivery.Email, err)
+				gaveUp, err := n.store.FailDelivery(
+					delivery.PostID,
+					delivery.SubscriberID,
+					err.Error(),
+				)
+				if err != nil {
+					log.Printf("Failed to record newsletter for post %v: %v", delivery.PostID, err)
+					return
+				}
+				if gaveUp {
+					log.Printf("Gave up sending post %v to %v", delivery.PostID, delivery.Email)
+				}
+			}
+		}
+
+		// failed deliveries wait out their retry delay, so a full batch means more are due
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// message renders a post as a mail. Members-only posts are cut down to the
+// same preview the public pages show.
+func (n *Newsletter) message(delivery models.NewsletterDelivery) mail.Message {
+	postURL := helpers.PostURL(delivery.Subdirectory, delivery.Slug)
+	unsubscribeURL := n.apiURL + "/subscribers/unsubscribe/" + delivery.UnsubscribeToken
+
+	content := delivery.ArticleContent
+	readMore := "Read it online"
+	if delivery.MembersOnly {
+		root, err := document.Decode(content)
+		if err != nil {
+			root = document.Node{}
+		}
+		content, _ = document.Truncate(root, helpers.IntFromEnv("PAYWALL_PREVIEW_BLOCKS", 3))
+		readMore = "Continue reading"
+	}
+
+	return mail.Message{
+		To:      delivery.Email,
+		Subject: delivery.Title,
+		Text: fmt.Sprintf(
+			"%v\n\n%v\n\n%v: %v\n\n--\nYou get this mail because you subscribed to %v.\n"+
+				"Unsubscribe: %v\n",
+			delivery.Title,
+			delivery.SmallDescription,
+			readMore,
+			postURL,
+			delivery.SiteName,
+			unsubscribeURL,
+		),
+		HTML: fmt.Sprintf(
+			"<h1>%v</h1>\n%v\n<p><a href=\"%v\">%v</a></p>\n<hr>\n"+
+				"<p>You get this mail because you subscribed to %v. "+
+				"<a href=\"%v\">Unsubscribe</a></p>\n",
+			html.EscapeString(delivery.Title),
+			render.HTML(content),
+			html.EscapeString(postURL),
+			readMore,
+			html.EscapeString(delivery.SiteName),
+			html.EscapeString(unsubscribeURL),
+		),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+type Purger struct {
+	stores    []models.TrashStore
+	interval  time.Duration
+	retention time.Duration
+}
+
+// NewPurger empties the trash of each store in order, so stores whose rows
+// cascade to others should come first.
+func NewPurger(interval, retention time.Duration, stores ...models.TrashStore) *Purger {
+	return &Purger{
+		stores:    stores,
+		interval:  interval,
+		retention: retention,
+	}
+}
+
+// Run deletes rows trashed longer than the retention every interval until ctx
+// is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	log.Println("Trash purger started, interval", p.interval, "retention", p.retention)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge()
+
+		select {
+		case <-ctx.Done():
+			log.Println("Trash purger stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purge() {
+	before := time.Now().Add(-p.retention)
+	for _, store := range p.stores {
+		purged, err := store.PurgeTrash(before)
+		if err != nil {
+			log.Println("Failed to purge trash:", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d trashed rows", purged)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+const batchSize = 100
+
+type Scheduler struct {
+	store    models.PostScheduleStore
+	interval time.Duration
+}
+
+func New(store models.PostScheduleStore, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		interval: interval,
+	}
+}
+
+// Run publishes due posts every interval until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	log.Println("Post scheduler started, interval", s.interval)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.publishDuePosts(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Post scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) publishDuePosts(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := s.store.PublishDuePosts(time.Now(), batchSize)
+		if err != nil {
+			log.Println("Failed to publish scheduled posts:", err)
+			return
+		}
+
+		for _, event := range events {
+			if event.Error != "" {
+				log.Printf(
+					"Failed to publish scheduled post %v (%v): %v",
+					event.PostID,
+					event.Outcome,
+					event.Error,
+				)
+				continue
+			}
+			log.Println("Published scheduled post", event.PostID)
+		}
+
+		// failed posts wait out their retry delay, so a full batch means more are due
+		if len(events) < batchSize {
+			return
+		}
+	}
+}
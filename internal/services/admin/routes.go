@@ -0,0 +1,46 @@
+// Package admin serves operational endpoints. They are only open to the users
+// listed in ADMIN_USER_IDS.
+package admin
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+type Handler struct {
+	adminUserIDs []string
+	caches       models.CacheStatsReporter
+}
+
+// NewHandler serves the admin routes to adminUserIDs. caches may be nil when
+// nothing is cached.
+func NewHandler(adminUserIDs []string, caches models.CacheStatsReporter) *Handler {
+	return &Handler{
+		adminUserIDs: adminUserIDs,
+		caches:       caches,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	adminRouter := router.NewRoute().Subrouter()
+	adminRouter.Use(middleware.WithAuth, middleware.WithAdmin(h.adminUserIDs))
+	if h.caches != nil {
+		adminRouter.HandleFunc("/cache/stats", h.GetCacheStats).Methods(http.MethodGet)
+	}
+}
+
+// GetCacheStats reports the hits and misses of the public read cache since
+// the server started.
+func (h *Handler) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	helpers.WriteJSONSuccess(
+		w,
+		http.StatusOK,
+		"Cache stats fetched successfully",
+		h.caches.Stats(),
+	)
+}
@@ -0,0 +1,292 @@
+package analytics
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+const (
+	defaultRangeDays = 30
+	maxRangeDays     = 366
+	maxReferrers     = 50
+)
+
+type Handler struct {
+	store          models.AnalyticsStore
+	trustedProxies []netip.Prefix
+	throttle       *viewThrottle
+}
+
+// NewHandler counts at most one view per address and post within
+// throttleWindow. Forwarding headers are only read from trustedProxies.
+func NewHandler(
+	store models.AnalyticsStore,
+	trustedProxies []netip.Prefix,
+	throttleWindow time.Duration,
+) *Handler {
+	return &Handler{
+		store:          store,
+		trustedProxies: trustedProxies,
+		throttle:       newViewThrottle(throttleWindow),
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/{siteID}/analytics/views", h.GetSiteViews).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/analytics/referrers", h.GetTopReferrers).
+		Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/analytics/views", h.GetPostViews).
+		Methods(http.MethodGet)
+
+	publicRouter := router.NewRoute().Subrouter()
+	publicRouter.HandleFunc("/posts/{subdirectory}/{slug}/views", h.RecordView).
+		Methods(http.MethodPost)
+}
+
+// RecordView is the beacon the reader site calls once a post is displayed.
+// Counting here rather than in the post endpoint keeps server side renders,
+// previews and crawlers out of the numbers.
+func (h *Handler) RecordView(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subdirectory := vars["subdirectory"]
+	slug := vars["slug"]
+
+	if isBot(r.UserAgent()) {
+		helpers.WriteJSONSuccess(w, http.StatusAccepted, "View ignored", nil)
+		return
+	}
+
+	var body struct {
+		Referrer string `json:"referrer"`
+	}
+	if r.ContentLength != 0 {
+		helpers.DecodeJSONBody(w, r, &body)
+	}
+	if body.Referrer == "" {
+		body.Referrer = r.Referer()
+	}
+
+	ip := h.clientIP(r)
+	if !h.throttle.allow(ip+"\x00"+subdirectory+"\x00"+slug, time.Now()) {
+		helpers.WriteJSONSuccess(w, http.StatusAccepted, "View ignored", nil)
+		return
+	}
+
+	view := models.PageView{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+		Referrer:  referrerHost(body.Referrer),
+	}
+	if err := h.store.RecordView(subdirectory, slug, view); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusAccepted, "View recorded", nil)
+}
+
+func (h *Handler) GetPostViews(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not specified")
+		return
+	}
+
+	from, to, err := getDateRange(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.store.GetPostViews(postID, siteID, userID, from, to)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Post views fetched successfully", report)
+}
+
+func (h *Handler) GetSiteViews(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	from, to, err := getDateRange(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.store.GetSiteViews(siteID, userID, from, to)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Site views fetched successfully", report)
+}
+
+func (h *Handler) GetTopReferrers(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	from, to, err := getDateRange(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := 10
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			helpers.WriteJSONError(w, http.StatusBadRequest, "Limit must be a positive integer")
+			return
+		}
+		limit = min(limit, maxReferrers)
+	}
+
+	var postID *string
+	if postIDParam := r.URL.Query().Get("post_id"); postIDParam != "" {
+		postID = &postIDParam
+	}
+
+	referrers, err := h.store.GetTopReferrers(siteID, userID, postID, from, to, limit)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Referrers fetched successfully", referrers)
+}
+
+// getDateRange reads the inclusive from and to days of a report, defaulting
+// to the last 30 days.
+func getDateRange(r *http.Request) (time.Time, time.Time, error) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from := to.AddDate(0, 0, 1-defaultRangeDays)
+
+	var err error
+	if toParam := r.URL.Query().Get("to"); toParam != "" {
+		to, err = time.ParseInLocation(time.DateOnly, toParam, time.Local)
+		if err != nil {
+			return from, to, errors.New("To must be a date formatted as YYYY-MM-DD")
+		}
+		from = to.AddDate(0, 0, 1-defaultRangeDays)
+	}
+	if fromParam := r.URL.Query().Get("from"); fromParam != "" {
+		from, err = time.ParseInLocation(time.DateOnly, fromParam, time.Local)
+		if err != nil {
+			return from, to, errors.New("From must be a date formatted as YYYY-MM-DD")
+		}
+	}
+
+	if from.After(to) {
+		return from, to, errors.New("From must not be after to")
+	}
+	if to.Sub(from) >= maxRangeDays*24*time.Hour {
+		return from, to, fmt.Errorf("Date range must not exceed %d days", maxRangeDays)
+	}
+
+	return from, to, nil
+}
+
+// referrerHost keeps only the host of a referrer, which is what the report
+// groups by and avoids storing full URLs that may carry personal data.
+func referrerHost(referrer string) string {
+	parsed, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	if len(host) > 255 {
+		return ""
+	}
+	return host
+}
+
+func isBot(userAgent string) bool {
+	userAgent = strings.ToLower(userAgent)
+	if userAgent == "" {
+		return true
+	}
+
+	for _, marker := range []string{"bot", "crawler", "spider", "slurp", "preview", "headless"} {
+		if strings.Contains(userAgent, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getUserIDAndSiteID(r *http.Request) (string, string, error) {
+	userID := r.Context().Value("userID").(string)
+	siteID := mux.Vars(r)["siteID"]
+
+	if userID == "" {
+		return userID, siteID, errors.New("User not found")
+	}
+
+	if siteID == "" {
+		return userID, siteID, errors.New("Site not found")
+	}
+
+	return userID, siteID, nil
+}
@@ -0,0 +1,319 @@
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+// RecordView adds one view to the daily buckets of a published post. The
+// reader is only kept as a hash salted with a per-day secret, which is enough
+// to count unique visitors within a day and useless for tracking them longer.
+func (s *Store) RecordView(subdirectory, slug string, view models.PageView) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var postID, siteID string
+	query := `
+		SELECT p.id, p.site_id
+		FROM posts p
+		INNER JOIN sites s
+		ON p.site_id = s.id
+		WHERE s.subdirectory = $1 AND p.slug = $2 AND p.status = 'published' AND p.published_at <= $3
+			AND p.deleted_at IS NULL AND s.deleted_at IS NULL
+	`
+	now := time.Now()
+	err := s.db.QueryRowContext(ctx, query, subdirectory, slug, now).Scan(&postID, &siteID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	salt, err := getDailySalt(ctx, tx, now)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256([]byte(salt + "|" + siteID + "|" + view.IP + "|" + view.UserAgent))
+	visitorHash := hex.EncodeToString(sum[:])
+
+	// the inserts tell whether the visitor is new, concurrent views of the
+	// same visitor cannot both see them as new
+	stmt := `
+		INSERT INTO analytics_site_visitors (site_id, day, visitor_hash)
+		VALUES ($1, $2::date, $3)
+		ON CONFLICT DO NOTHING
+	`
+	result, err := tx.ExecContext(ctx, stmt, siteID, now, visitorHash)
+	if err != nil {
+		return err
+	}
+	newToSite, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	stmt = `
+		INSERT INTO analytics_visitors (post_id, site_id, day, visitor_hash)
+		VALUES ($1, $2, $3::date, $4)
+		ON CONFLICT DO NOTHING
+	`
+	result, err = tx.ExecContext(ctx, stmt, postID, siteID, now, visitorHash)
+	if err != nil {
+		return err
+	}
+	newToPost, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	stmt = `
+		INSERT INTO post_views_daily (post_id, site_id, day, views, unique_visitors)
+		VALUES ($1, $2, $3::date, 1, $4)
+		ON CONFLICT (post_id, day) DO UPDATE
+		SET
+			views = post_views_daily.views + 1,
+			unique_visitors = post_views_daily.unique_visitors + EXCLUDED.unique_visitors
+	`
+	if _, err = tx.ExecContext(ctx, stmt, postID, siteID, now, newToPost); err != nil {
+		return err
+	}
+
+	stmt = `
+		INSERT INTO site_views_daily (site_id, day, views, unique_visitors)
+		VALUES ($1, $2::date, 1, $3)
+		ON CONFLICT (site_id, day) DO UPDATE
+		SET
+			views = site_views_daily.views + 1,
+			unique_visitors = site_views_daily.unique_visitors + EXCLUDED.unique_visitors
+	`
+	if _, err = tx.ExecContext(ctx, stmt, siteID, now, newToSite); err != nil {
+		return err
+	}
+
+	if view.Referrer != "" {
+		stmt = `
+			INSERT INTO post_referrers_daily (post_id, site_id, day, referrer, views)
+			VALUES ($1, $2, $3::date, $4, 1)
+			ON CONFLICT (post_id, day, referrer) DO UPDATE
+			SET views = post_referrers_daily.views + 1
+		`
+		if _, err = tx.ExecContext(ctx, stmt, postID, siteID, now, view.Referrer); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getDailySalt returns the salt for today, creating it on the first view of
+// the day. Creating it also drops older salts and visitor hashes, since the
+// daily buckets already hold everything worth keeping from them.
+func getDailySalt(ctx context.Context, tx *sql.Tx, now time.Time) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	stmt := `
+		INSERT INTO analytics_salts (day, salt)
+		VALUES ($1::date, $2)
+		ON CONFLICT (day) DO NOTHING
+	`
+	result, err := tx.ExecContext(ctx, stmt, now, hex.EncodeToString(random))
+	if err != nil {
+		return "", err
+	}
+	created, err := result.RowsAffected()
+	if err != nil {
+		return "", err
+	}
+
+	if created > 0 {
+		stmt = `DELETE FROM analytics_salts WHERE day < $1::date`
+		if _, err = tx.ExecContext(ctx, stmt, now); err != nil {
+			return "", err
+		}
+		stmt = `DELETE FROM analytics_visitors WHERE day < $1::date`
+		if _, err = tx.ExecContext(ctx, stmt, now); err != nil {
+			return "", err
+		}
+		stmt = `DELETE FROM analytics_site_visitors WHERE day < $1::date`
+		if _, err = tx.ExecContext(ctx, stmt, now); err != nil {
+			return "", err
+		}
+	}
+
+	var salt string
+	query := `SELECT salt FROM analytics_salts WHERE day = $1::date`
+	if err = tx.QueryRowContext(ctx, query, now).Scan(&salt); err != nil {
+		return "", err
+	}
+
+	return salt, nil
+}
+
+func (s *Store) GetPostViews(
+	postID, siteID, userID string,
+	from, to time.Time,
+) (*models.ViewsReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var owned bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM posts p
+			INNER JOIN sites s
+			ON p.site_id = s.id
+			WHERE p.id = $1 AND p.site_id = $2 AND s.user_id = $3
+		)
+	`
+	err := s.db.QueryRowContext(ctx, query, postID, siteID, userID).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, sql.ErrNoRows
+	}
+
+	query = `
+		SELECT d.day, COALESCE(v.views, 0), COALESCE(v.unique_visitors, 0)
+		FROM generate_series($1::date, $2::date, INTERVAL '1 day') AS d(day)
+		LEFT JOIN post_views_daily v
+		ON v.day = d.day::date AND v.post_id = $3
+		ORDER BY d.day
+	`
+	rows, err := s.db.QueryContext(ctx, query, from, to, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanViewsReport(rows)
+}
+
+func (s *Store) GetSiteViews(
+	siteID, userID string,
+	from, to time.Time,
+) (*models.ViewsReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var owned bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sites
+			WHERE id = $1 AND user_id = $2
+		)
+	`
+	err := s.db.QueryRowContext(ctx, query, siteID, userID).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, sql.ErrNoRows
+	}
+
+	query = `
+		SELECT d.day, COALESCE(v.views, 0), COALESCE(v.unique_visitors, 0)
+		FROM generate_series($1::date, $2::date, INTERVAL '1 day') AS d(day)
+		LEFT JOIN site_views_daily v
+		ON v.day = d.day::date AND v.site_id = $3
+		ORDER BY d.day
+	`
+	rows, err := s.db.QueryContext(ctx, query, from, to, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanViewsReport(rows)
+}
+
+func scanViewsReport(rows *sql.Rows) (*models.ViewsReport, error) {
+	report := &models.ViewsReport{Days: []models.DailyViews{}}
+	for rows.Next() {
+		var day time.Time
+		var views models.DailyViews
+		if err := rows.Scan(&day, &views.Views, &views.UniqueVisitors); err != nil {
+			return nil, err
+		}
+		views.Day = day.Format(time.DateOnly)
+
+		report.Views += views.Views
+		report.VisitorDays += views.UniqueVisitors
+		report.Days = append(report.Days, views)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func (s *Store) GetTopReferrers(
+	siteID, userID string,
+	postID *string,
+	from, to time.Time,
+	limit int,
+) ([]models.ReferrerViews, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT r.referrer, SUM(r.views)
+		FROM post_referrers_daily r
+		INNER JOIN sites s
+		ON r.site_id = s.id
+		WHERE r.site_id = $1 AND s.user_id = $2
+			AND ($3::varchar IS NULL OR r.post_id = $3)
+			AND r.day BETWEEN $4::date AND $5::date
+		GROUP BY r.referrer
+		ORDER BY SUM(r.views) DESC, r.referrer
+		LIMIT $6
+	`
+	rows, err := s.db.QueryContext(ctx, query, siteID, userID, postID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	referrers := []models.ReferrerViews{}
+	for rows.Next() {
+		var referrer models.ReferrerViews
+		if err := rows.Scan(&referrer.Referrer, &referrer.Views); err != nil {
+			return nil, err
+		}
+		referrers = append(referrers, referrer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return referrers, nil
+}
@@ -0,0 +1,140 @@
+package analytics
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxThrottledViews bounds how many recent views the throttle remembers.
+// Once it is full and nothing has expired, further views are not counted.
+const maxThrottledViews = 100_000
+
+// ParseTrustedProxies reads a comma separated list of proxy addresses and
+// CIDR ranges, such as the TRUSTED_PROXIES setting.
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid trusted proxy %q: %w", entry, err)
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return proxies, nil
+}
+
+// clientIP is the address a view came from. Forwarding headers are only
+// believed when the connection comes from a trusted proxy, and
+// X-Forwarded-For is read from the right so entries a client added itself
+// are never reached.
+func (h *Handler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !h.isTrustedProxy(host) {
+		return host
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if hop != "" && !h.isTrustedProxy(hop) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+
+	return host
+}
+
+func (h *Handler) isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, proxy := range h.trustedProxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// viewThrottle remembers which address viewed which post recently, so
+// reloading a page or replaying the beacon does not add views.
+type viewThrottle struct {
+	mu      sync.Mutex
+	window  time.Duration
+	seen    map[string]time.Time
+	sweptAt time.Time
+}
+
+func newViewThrottle(window time.Duration) *viewThrottle {
+	return &viewThrottle{
+		window: window,
+		seen:   map[string]time.Time{},
+	}
+}
+
+// allow reports whether a view under key counts, and if so starts a new
+// window for it.
+func (t *viewThrottle) allow(key string, now time.Time) bool {
+	if t.window <= 0 {
+		return true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	last, ok := t.seen[key]
+	if ok && now.Sub(last) < t.window {
+		return false
+	}
+
+	if !ok && len(t.seen) >= maxThrottledViews {
+		// sweeping walks every entry, so a full throttle does it at most
+		// once a second
+		if now.Sub(t.sweptAt) >= time.Second {
+			for seenKey, seenAt := range t.seen {
+				if now.Sub(seenAt) >= t.window {
+					delete(t.seen, seenKey)
+				}
+			}
+			t.sweptAt = now
+		}
+		if len(t.seen) >= maxThrottledViews {
+			return false
+		}
+	}
+
+	t.seen[key] = now
+	return true
+}
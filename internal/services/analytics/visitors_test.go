@@ -0,0 +1,142 @@
+package analytics
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestHandler(t *testing.T, trustedProxies string) *Handler {
+	t.Helper()
+
+	proxies, err := ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(nil, proxies, time.Minute)
+}
+
+func TestClientIP(t *testing.T) {
+	h := newTestHandler(t, "10.0.0.0/8, 192.168.1.1")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:1234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer sending headers",
+			remoteAddr: "203.0.113.7:1234",
+			forwarded:  []string{"198.51.100.1"},
+			realIP:     "198.51.100.2",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "spoofed entries left of the client",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"1.2.3.4, 198.51.100.1"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  []string{"198.51.100.1, 192.168.1.1", "10.0.0.2"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "real IP from a trusted proxy",
+			remoteAddr: "[::ffff:10.0.0.1]:1234",
+			realIP:     "198.51.100.2",
+			want:       "198.51.100.2",
+		},
+		{
+			name:       "trusted proxy without headers",
+			remoteAddr: "10.0.0.1:1234",
+			want:       "10.0.0.1",
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, value := range test.forwarded {
+			r.Header.Add("X-Forwarded-For", value)
+		}
+		if test.realIP != "" {
+			r.Header.Set("X-Real-IP", test.realIP)
+		}
+
+		if got := h.clientIP(r); got != test.want {
+			t.Errorf("%v: clientIP() = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseTrustedProxiesRejectsGarbage(t *testing.T) {
+	if _, err := ParseTrustedProxies("10.0.0.0/8, proxy.local"); err == nil {
+		t.Error("ParseTrustedProxies() returned no error")
+	}
+}
+
+func TestViewThrottleAllowsOncePerWindow(t *testing.T) {
+	throttle := newViewThrottle(time.Minute)
+	now := time.Now()
+
+	if !throttle.allow("a", now) {
+		t.Error("first view not allowed")
+	}
+	if throttle.allow("a", now.Add(time.Minute-time.Nanosecond)) {
+		t.Error("repeated view within the window allowed")
+	}
+	if !throttle.allow("b", now) {
+		t.Error("view under another key not allowed")
+	}
+	if !throttle.allow("a", now.Add(time.Minute)) {
+		t.Error("view after the window not allowed")
+	}
+}
+
+func TestViewThrottleDisabled(t *testing.T) {
+	throttle := newViewThrottle(0)
+	now := time.Now()
+
+	for range 2 {
+		if !throttle.allow("a", now) {
+			t.Error("view not allowed without a window")
+		}
+	}
+}
+
+func TestViewThrottleWhenFull(t *testing.T) {
+	throttle := newViewThrottle(time.Minute)
+	now := time.Now()
+	for i := range maxThrottledViews {
+		throttle.seen[strconv.Itoa(i)] = now
+	}
+
+	if throttle.allow("new", now.Add(time.Second)) {
+		t.Error("view allowed while the throttle is full")
+	}
+
+	// once the remembered views expire a sweep makes room
+	if !throttle.allow("new", now.Add(time.Minute)) {
+		t.Error("view not allowed after the remembered views expired")
+	}
+	if len(throttle.seen) != 1 {
+		t.Errorf("throttle remembers %d views, want 1", len(throttle.seen))
+	}
+}
@@ -0,0 +1,221 @@
+package categories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+type Handler struct {
+	store models.CategoryStore
+}
+
+func NewHandler(store models.CategoryStore) *Handler {
+	return &Handler{
+		store: store,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/{siteID}/categories", h.GetAllCategories).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/categories", h.CreateCategory).Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/categories/{categoryID}", h.UpdateCategory).
+		Methods(http.MethodPatch)
+	authRouter.HandleFunc("/{siteID}/categories/{categoryID}", h.DeleteCategory).
+		Methods(http.MethodDelete)
+}
+
+func (h *Handler) GetAllCategories(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	categories, err := h.store.GetCategoriesBySiteID(siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Categories fetched successfully", categories)
+}
+
+func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	newCategory := new(models.CreateCategoryPayload)
+	helpers.DecodeJSONBody(w, r, newCategory)
+
+	if err := helpers.Validate.Struct(newCategory); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid Payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	slug := helpers.TopicSlug(newCategory.Name)
+	if slug == "" {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			"Category name must contain letters or digits",
+		)
+		return
+	}
+
+	existing, err := h.store.GetCategoryBySlug(slug, siteID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if existing != nil {
+		helpers.WriteJSONError(w, http.StatusConflict, "Category with this name already exists")
+		return
+	}
+
+	category, err := h.store.CreateCategory(*newCategory, siteID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusCreated, "Category created successfully", category)
+}
+
+func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	categoryID := mux.Vars(r)["categoryID"]
+	if categoryID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Category ID not found")
+		return
+	}
+
+	categoryPayload := new(models.CreateCategoryPayload)
+	helpers.DecodeJSONBody(w, r, categoryPayload)
+
+	if err := helpers.Validate.Struct(categoryPayload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	slug := helpers.TopicSlug(categoryPayload.Name)
+	if slug == "" {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			"Category name must contain letters or digits",
+		)
+		return
+	}
+
+	existing, err := h.store.GetCategoryBySlug(slug, siteID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if existing != nil && existing.ID != categoryID {
+		helpers.WriteJSONError(w, http.StatusConflict, "Category with this name already exists")
+		return
+	}
+
+	if err = h.store.UpdateCategory(*categoryPayload, categoryID, siteID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Category updated successfully", nil)
+}
+
+func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	categoryID := mux.Vars(r)["categoryID"]
+	if categoryID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Category ID not found")
+		return
+	}
+
+	if err := h.store.DeleteCategory(categoryID, siteID, userID); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Category deleted successfully", nil)
+}
+
+func getUserIDAndSiteID(r *http.Request) (string, string, error) {
+	userID := r.Context().Value("userID").(string)
+	siteID := mux.Vars(r)["siteID"]
+
+	if userID == "" {
+		return userID, siteID, errors.New("User not found")
+	}
+
+	if siteID == "" {
+		return userID, siteID, errors.New("Site not found")
+	}
+
+	return userID, siteID, nil
+}
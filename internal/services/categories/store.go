@@ -0,0 +1,71 @@
+package categories
+
+import (
+	"database/sql"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/services/topics"
+)
+
+type Store struct {
+	topics *topics.Store
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		topics: topics.NewStore(db, topics.Categories),
+	}
+}
+
+func (s *Store) GetCategoriesBySiteID(siteID, userID string) ([]models.Category, error) {
+	topics, err := s.topics.GetTopicsBySiteID(siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories []models.Category
+	for _, topic := range topics {
+		categories = append(categories, models.Category(topic))
+	}
+
+	return categories, nil
+}
+
+func (s *Store) GetCategoryBySlug(slug, siteID string) (*models.Category, error) {
+	topic, err := s.topics.GetTopicBySlug(slug, siteID)
+	if err != nil || topic == nil {
+		return nil, err
+	}
+
+	category := models.Category(*topic)
+	return &category, nil
+}
+
+func (s *Store) CreateCategory(
+	newCategory models.CreateCategoryPayload,
+	siteID, userID string,
+) (*models.Category, error) {
+	topic, err := s.topics.CreateTopic(
+		newCategory.Name,
+		newCategory.Description,
+		siteID,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	category := models.Category(*topic)
+	return &category, nil
+}
+
+func (s *Store) UpdateCategory(
+	category models.CreateCategoryPayload,
+	categoryID, siteID, userID string,
+) error {
+	return s.topics.UpdateTopic(category.Name, category.Description, categoryID, siteID, userID)
+}
+
+func (s *Store) DeleteCategory(categoryID, siteID, userID string) error {
+	return s.topics.DeleteTopic(categoryID, siteID, userID)
+}
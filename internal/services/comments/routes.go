@@ -0,0 +1,242 @@
+package comments
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+)
+
+type Handler struct {
+	store models.CommentStore
+}
+
+func NewHandler(store models.CommentStore) *Handler {
+	return &Handler{
+		store: store,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/{siteID}/comments", h.GetSiteComments).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/comments/{commentID}/approve", h.ApproveComment).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/comments/{commentID}/reject", h.RejectComment).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/comments/{commentID}/spam", h.MarkCommentAsSpam).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/comments/{commentID}", h.DeleteComment).
+		Methods(http.MethodDelete)
+
+	publicRouter := router.NewRoute().Subrouter()
+	publicRouter.HandleFunc("/posts/{subdirectory}/{slug}/comments", h.GetPostComments).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/{slug}/comments", h.CreateComment).
+		Methods(http.MethodPost)
+}
+
+func (h *Handler) GetPostComments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subdirectory := vars["subdirectory"]
+	slug := vars["slug"]
+
+	comments, err := h.store.GetPostComments(subdirectory, slug)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Comments fetched successfully", comments)
+}
+
+func (h *Handler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subdirectory := vars["subdirectory"]
+	slug := vars["slug"]
+
+	newComment := new(models.CreateCommentPayload)
+	helpers.DecodeJSONBody(w, r, newComment)
+
+	if err := helpers.Validate.Struct(newComment); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid Payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	comment, err := h.store.CreateComment(subdirectory, slug, *newComment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		if errors.Is(err, ErrParentNotFound) {
+			helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(
+		w,
+		http.StatusCreated,
+		"Comment submitted and awaiting moderation",
+		comment,
+	)
+}
+
+func (h *Handler) GetSiteComments(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.CommentStatusPending
+	case models.CommentStatusPending,
+		models.CommentStatusApproved,
+		models.CommentStatusRejected,
+		models.CommentStatusSpam:
+	default:
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			"Status must be one of pending, approved, rejected or spam",
+		)
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	comments, nextPage, err := h.store.GetSiteComments(siteID, userID, status, page)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONPage(w, http.StatusOK, "Comments fetched successfully", comments, nextPage)
+}
+
+func (h *Handler) ApproveComment(w http.ResponseWriter, r *http.Request) {
+	h.moderateComment(w, r, models.CommentStatusApproved, "Comment approved")
+}
+
+func (h *Handler) RejectComment(w http.ResponseWriter, r *http.Request) {
+	h.moderateComment(w, r, models.CommentStatusRejected, "Comment rejected")
+}
+
+func (h *Handler) MarkCommentAsSpam(w http.ResponseWriter, r *http.Request) {
+	h.moderateComment(w, r, models.CommentStatusSpam, "Comment marked as spam")
+}
+
+func (h *Handler) moderateComment(
+	w http.ResponseWriter,
+	r *http.Request,
+	status, message string,
+) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	commentID := mux.Vars(r)["commentID"]
+	if commentID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Comment ID not found")
+		return
+	}
+
+	if err := h.store.UpdateCommentStatus(commentID, siteID, userID, status); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Comment not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, message, nil)
+}
+
+func (h *Handler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	commentID := mux.Vars(r)["commentID"]
+	if commentID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Comment ID not found")
+		return
+	}
+
+	if err := h.store.DeleteComment(commentID, siteID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Comment not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Comment deleted successfully", nil)
+}
+
+func getUserIDAndSiteID(r *http.Request) (string, string, error) {
+	userID := r.Context().Value("userID").(string)
+	siteID := mux.Vars(r)["siteID"]
+
+	if userID == "" {
+		return userID, siteID, errors.New("User not found")
+	}
+
+	if siteID == "" {
+		return userID, siteID, errors.New("Site not found")
+	}
+
+	return userID, siteID, nil
+}
@@ -0,0 +1,298 @@
+package comments
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+)
+
+var ErrParentNotFound = errors.New("Parent comment not found")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func (s *Store) getPublishedPostID(ctx context.Context, subdirectory, slug string) (string, error) {
+	var postID string
+	query := `
+		SELECT p.id
+		FROM posts p
+		INNER JOIN sites s
+		ON p.site_id = s.id
+		WHERE s.subdirectory = $1 AND p.slug = $2 AND p.status = 'published' AND p.published_at <= $3
+			AND p.deleted_at IS NULL AND s.deleted_at IS NULL
+	`
+	err := s.db.QueryRowContext(ctx, query, subdirectory, slug, time.Now()).Scan(&postID)
+	if err != nil {
+		return "", err
+	}
+
+	return postID, nil
+}
+
+func (s *Store) CreateComment(
+	subdirectory, slug string,
+	comment models.CreateCommentPayload,
+) (*models.Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	postID, err := s.getPublishedPostID(ctx, subdirectory, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	// readers can only reply to comments they can see
+	if comment.ParentID != nil {
+		var exists bool
+		query := `
+			SELECT EXISTS (
+				SELECT 1 FROM comments
+				WHERE id = $1 AND post_id = $2 AND status = 'approved'
+			)
+		`
+		err = s.db.QueryRowContext(ctx, query, *comment.ParentID, postID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrParentNotFound
+		}
+	}
+
+	stmt := `
+		INSERT INTO comments
+			(id, post_id, parent_id, author_name, author_email, body, status, created_at, updated_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		RETURNING id, post_id, parent_id, author_name, body, status, created_at, updated_at
+	`
+
+	uuid, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	newComment := new(models.Comment)
+	err = s.db.QueryRowContext(ctx, stmt,
+		uuid,
+		postID,
+		comment.ParentID,
+		comment.AuthorName,
+		comment.AuthorEmail,
+		comment.Body,
+		models.CommentStatusPending,
+		time.Now(),
+	).Scan(
+		&newComment.ID,
+		&newComment.PostID,
+		&newComment.ParentID,
+		&newComment.AuthorName,
+		&newComment.Body,
+		&newComment.Status,
+		&newComment.CreatedAt,
+		&newComment.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return newComment, nil
+}
+
+// GetPostComments returns the approved comments of a published post as a
+// tree. Replies whose parent is not approved are left out with it.
+func (s *Store) GetPostComments(subdirectory, slug string) ([]models.Comment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	postID, err := s.getPublishedPostID(ctx, subdirectory, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT id, post_id, parent_id, author_name, body, status, created_at, updated_at
+		FROM comments
+		WHERE post_id = $1 AND status = 'approved'
+		ORDER BY created_at, id
+	`
+	rows, err := s.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.ParentID,
+			&comment.AuthorName,
+			&comment.Body,
+			&comment.Status,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildThreads(comments), nil
+}
+
+// buildThreads nests comments under their parents. Comments arrive oldest
+// first, so replies keep their chronological order within a thread.
+func buildThreads(comments []models.Comment) []models.Comment {
+	children := map[string][]models.Comment{}
+	var roots []models.Comment
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+			continue
+		}
+		children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+	}
+
+	var attach func(comments []models.Comment) []models.Comment
+	attach = func(comments []models.Comment) []models.Comment {
+		for i := range comments {
+			comments[i].Replies = attach(children[comments[i].ID])
+		}
+		return comments
+	}
+
+	return attach(roots)
+}
+
+func (s *Store) GetSiteComments(
+	siteID, userID, status string,
+	page pagination.Params,
+) ([]models.Comment, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			c.id, c.post_id, p.title, c.parent_id, c.author_name, c.author_email, c.body, c.status,
+			c.created_at, c.updated_at
+		FROM comments c
+		INNER JOIN posts p
+		ON c.post_id = p.id
+		INNER JOIN sites s
+		ON p.site_id = s.id
+		WHERE p.site_id = $1 AND s.user_id = $2 AND c.status = $3
+	`
+	clause, args := page.Clause("c.created_at", "c.id", []any{siteID, userID, status})
+
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.PostTitle,
+			&comment.ParentID,
+			&comment.AuthorName,
+			&comment.AuthorEmail,
+			&comment.Body,
+			&comment.Status,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+		)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+		comments = append(comments, comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	comments, nextPage := pagination.Trim(comments, page, func(comment models.Comment) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: comment.CreatedAt, ID: comment.ID}
+	})
+	return comments, nextPage, nil
+}
+
+func (s *Store) UpdateCommentStatus(commentID, siteID, userID, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE comments c
+		SET
+			status = $1,
+			updated_at = $2
+		FROM posts p, sites s
+		WHERE c.post_id = p.id AND p.site_id = s.id
+			AND c.id = $3 AND p.site_id = $4 AND s.user_id = $5
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt, status, time.Now(), commentID, siteID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteComment(commentID, siteID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		DELETE FROM comments c
+		USING posts p, sites s
+		WHERE c.post_id = p.id AND p.site_id = s.id
+			AND c.id = $1 AND p.site_id = $2 AND s.user_id = $3
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt, commentID, siteID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
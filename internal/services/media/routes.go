@@ -0,0 +1,726 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"github.com/mznrasil/my-blogs-be/internal/filestore"
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/imaging"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+)
+
+// allowedTypes are the sniffed content types uploads may have. SVG and HTML
+// are left out since browsers would run scripts in them.
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+type Handler struct {
+	store models.MediaStore
+	files filestore.Store
+	// resizeSlots bounds how many images ResizeMedia decodes at once
+	resizeSlots chan struct{}
+	resizesMu   sync.Mutex
+	resizes     map[string]*resize
+}
+
+// NewHandler serves media from files. At most maxResizes images are decoded
+// for the resize endpoint at a time.
+func NewHandler(store models.MediaStore, files filestore.Store, maxResizes int) *Handler {
+	return &Handler{
+		store:       store,
+		files:       files,
+		resizeSlots: make(chan struct{}, max(maxResizes, 1)),
+		resizes:     map[string]*resize{},
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/media/usage", h.GetMediaUsage).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/media", h.GetMediaBySiteID).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/media", h.UploadMedia).Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/media/{mediaID}", h.DeleteMedia).Methods(http.MethodDelete)
+
+	// media IDs are UUIDs, so "resize" can't be mistaken for one
+	publicRouter := router.NewRoute().Subrouter()
+	publicRouter.HandleFunc("/media/resize/{mediaID}", h.ResizeMedia).Methods(http.MethodGet)
+	publicRouter.HandleFunc("/media/{mediaID}/variants/{name}", h.GetMediaVariant).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/media/{mediaID}/{filename}", h.GetMediaFile).
+		Methods(http.MethodGet)
+}
+
+// setURLs points media and its variants at where they are served. root is
+// the URL the API routes are mounted under.
+func setURLs(root string, media *models.Media) {
+	media.URL = imaging.MediaURL(root, media.ID, media.Filename)
+	for i := range media.Variants {
+		media.Variants[i].URL = imaging.VariantURL(root, media.ID, media.Variants[i].Name)
+	}
+}
+
+// cleanFilename keeps the last path element of an uploaded file's name, since
+// browsers on Windows send full paths.
+func cleanFilename(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, `\`, "/"))
+	if filename == "." || filename == "/" || !utf8.ValidString(filename) {
+		return "upload"
+	}
+	for len(filename) > 255 {
+		_, size := utf8.DecodeLastRuneInString(filename)
+		filename = filename[:len(filename)-size]
+	}
+
+	return filename
+}
+
+func (h *Handler) UploadMedia(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	maxUploadSize := int64(helpers.IntFromEnv("MEDIA_MAX_UPLOAD_BYTES", 10<<20))
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			helpers.WriteJSONError(
+				w,
+				http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("File must be at most %d bytes", maxUploadSize),
+			)
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid file: %v", err.Error()),
+		)
+		return
+	}
+	defer file.Close()
+
+	// the type is sniffed from the content, the client's claim is ignored
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid file: %v", err.Error()),
+		)
+		return
+	}
+	head = head[:n]
+	mimeType := http.DetectContentType(head)
+	if !allowedTypes[mimeType] {
+		helpers.WriteJSONError(
+			w,
+			http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Unsupported file type: %v", mimeType),
+		)
+		return
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	media := models.Media{
+		ID:         id.String(),
+		UserID:     userID,
+		SiteID:     siteID,
+		Filename:   cleanFilename(header.Filename),
+		MimeType:   mimeType,
+		StorageKey: siteID + "/" + id.String(),
+		CreatedAt:  time.Now(),
+	}
+
+	// the file is recorded before it is stored, so uploads to sites the user
+	// does not own or beyond their quota never reach the disk
+	var data bytes.Buffer
+	if _, err = data.ReadFrom(io.MultiReader(bytes.NewReader(head), file)); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid file: %v", err.Error()),
+		)
+		return
+	}
+	checksum := sha256.Sum256(data.Bytes())
+	media.Size = int64(data.Len())
+	media.Checksum = hex.EncodeToString(checksum[:])
+
+	if imaging.IsImage(mimeType) {
+		width, height, err := imaging.DecodeConfig(data.Bytes())
+		if err != nil {
+			helpers.WriteJSONError(
+				w,
+				http.StatusBadRequest,
+				fmt.Sprintf("Invalid image: %v", err.Error()),
+			)
+			return
+		}
+		media.Width = &width
+		media.Height = &height
+	}
+
+	if err = h.store.CreateMedia(media); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		if errors.Is(err, ErrQuotaExceeded) {
+			helpers.WriteJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if _, err = h.files.Put(media.StorageKey, bytes.NewReader(data.Bytes())); err != nil {
+		if _, deleteErr := h.store.DeleteMedia(media.ID, siteID, userID); deleteErr != nil {
+			log.Printf("Failed to delete record of unstored media %v: %v", media.ID, deleteErr)
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if media.Width != nil {
+		media.Variants = h.createVariants(media, data.Bytes())
+	}
+
+	setURLs(helpers.APIRootURL(r, "/"+siteID+"/media"), &media)
+	helpers.WriteJSONSuccess(w, http.StatusCreated, "Media uploaded successfully", media)
+}
+
+func (h *Handler) GetMediaBySiteID(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	mediaList, nextPage, err := h.store.GetMediaBySiteID(siteID, userID, page)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	root := helpers.APIRootURL(r, "/"+siteID+"/media")
+	for i := range mediaList {
+		setURLs(root, &mediaList[i])
+	}
+
+	helpers.WriteJSONPage(w, http.StatusOK, "Media fetched successfully", mediaList, nextPage)
+}
+
+func (h *Handler) DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mediaID := mux.Vars(r)["mediaID"]
+
+	media, err := h.store.DeleteMedia(mediaID, siteID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Media not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	// the record is gone, files that fail to delete here are swept by the
+	// trash purger
+	keys := []string{media.StorageKey}
+	for _, variant := range media.Variants {
+		keys = append(keys, variant.StorageKey)
+	}
+	for _, key := range keys {
+		if err = h.files.Delete(key); err != nil {
+			log.Println("Failed to delete media file", key, err)
+		}
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Media deleted successfully", nil)
+}
+
+func (h *Handler) GetMediaUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(string)
+
+	usage, err := h.store.GetMediaUsage(userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Media usage fetched successfully", usage)
+}
+
+// GetMediaFile serves an uploaded file. Files never change under their ID, so
+// they can be cached for good.
+func (h *Handler) GetMediaFile(w http.ResponseWriter, r *http.Request) {
+	mediaID := mux.Vars(r)["mediaID"]
+
+	media, err := h.store.GetMediaByID(mediaID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if media == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Media not found")
+		return
+	}
+
+	h.serveFile(
+		w,
+		r,
+		media.StorageKey,
+		media.MimeType,
+		media.Size,
+		`"`+media.Checksum+`"`,
+		media.CreatedAt,
+	)
+}
+
+func (h *Handler) GetMediaVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	media, err := h.store.GetMediaByID(vars["mediaID"])
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if media == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Media not found")
+		return
+	}
+
+	variant, err := h.store.GetMediaVariant(media.ID, vars["name"])
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if variant == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Variant not found")
+		return
+	}
+
+	h.serveFile(
+		w,
+		r,
+		variant.StorageKey,
+		variant.MimeType,
+		variant.Size,
+		`"`+variant.ID+`"`,
+		variant.CreatedAt,
+	)
+}
+
+// ResizeMedia serves an image at ?width=, one of imaging.Widths, in
+// ?format=, jpg, png or webp. The first request makes the variant, later ones get
+// the stored copy. Anyone can call it, so the widths are fixed, decodes are
+// bounded and concurrent requests for one variant share the work.
+func (h *Handler) ResizeMedia(w http.ResponseWriter, r *http.Request) {
+	width, err := strconv.Atoi(r.URL.Query().Get("width"))
+	if err != nil || !slices.Contains(imaging.Widths, width) {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Width must be one of %v", imaging.Widths),
+		)
+		return
+	}
+
+	media, err := h.store.GetMediaByID(mux.Vars(r)["mediaID"])
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if media == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Media not found")
+		return
+	}
+	if media.Width == nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Only images can be resized")
+		return
+	}
+
+	format := imaging.FallbackFormat(media.MimeType)
+	if name := r.URL.Query().Get("format"); name != "" {
+		var ok bool
+		if format, ok = imaging.FormatByName(name); !ok {
+			helpers.WriteJSONError(w, http.StatusBadRequest, "Format must be jpg, png or webp")
+			return
+		}
+	}
+
+	width = min(width, *media.Width)
+	variant, err := h.store.GetMediaVariant(media.ID, imaging.VariantName(width, format))
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if variant != nil {
+		h.serveFile(
+			w,
+			r,
+			variant.StorageKey,
+			variant.MimeType,
+			variant.Size,
+			`"`+variant.ID+`"`,
+			variant.CreatedAt,
+		)
+		return
+	}
+
+	variant, body, err := h.resizeOnce(r.Context(), media, width, format)
+	if err != nil {
+		if errors.Is(err, imaging.ErrTooLarge) {
+			helpers.WriteJSONError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			helpers.WriteJSONError(
+				w,
+				http.StatusServiceUnavailable,
+				"Too many images are being resized, try again later",
+			)
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", `"`+variant.ID+`"`)
+	w.Header().Set("Content-Type", variant.MimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// resize is a variant ResizeMedia is making. Requests for the same variant
+// wait for it instead of decoding the image again.
+type resize struct {
+	done    chan struct{}
+	variant *models.MediaVariant
+	body    []byte
+	err     error
+}
+
+// resizeOnce makes the variant of media at width in format, or waits for the
+// request already making it. Waiting for a decode slot gives up with ctx.
+func (h *Handler) resizeOnce(
+	ctx context.Context,
+	media *models.Media,
+	width int,
+	format imaging.Format,
+) (*models.MediaVariant, []byte, error) {
+	key := media.ID + "/" + imaging.VariantName(width, format)
+
+	h.resizesMu.Lock()
+	if pending, ok := h.resizes[key]; ok {
+		h.resizesMu.Unlock()
+		select {
+		case <-pending.done:
+			return pending.variant, pending.body, pending.err
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+	pending := &resize{done: make(chan struct{})}
+	h.resizes[key] = pending
+	h.resizesMu.Unlock()
+
+	defer func() {
+		h.resizesMu.Lock()
+		delete(h.resizes, key)
+		h.resizesMu.Unlock()
+		close(pending.done)
+	}()
+
+	select {
+	case h.resizeSlots <- struct{}{}:
+	case <-ctx.Done():
+		pending.err = ctx.Err()
+		return nil, nil, pending.err
+	}
+	defer func() { <-h.resizeSlots }()
+
+	img, err := h.decodeMedia(media)
+	if err != nil {
+		pending.err = err
+		return nil, nil, err
+	}
+
+	pending.variant, pending.body, pending.err = h.createVariant(
+		*media,
+		imaging.Resize(img, width),
+		format,
+		true,
+	)
+	return pending.variant, pending.body, pending.err
+}
+
+func (h *Handler) decodeMedia(media *models.Media) (image.Image, error) {
+	file, err := h.files.Open(media.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return imaging.Decode(data)
+}
+
+// createVariants makes the srcset variants of an uploaded image, each width
+// in the fallback format and, when that comes out smaller, as WebP too. They
+// are a nicety, so failures are logged and the upload still succeeds.
+func (h *Handler) createVariants(media models.Media, data []byte) []models.MediaVariant {
+	img, err := imaging.Decode(data)
+	if err != nil {
+		log.Printf("Failed to decode media %v: %v", media.ID, err)
+		return nil
+	}
+
+	var variants []models.MediaVariant
+	format := imaging.FallbackFormat(media.MimeType)
+	for _, width := range imaging.Widths {
+		if width >= img.Bounds().Dx() {
+			break
+		}
+
+		resized := imaging.Resize(img, width)
+		variant, fallback, err := h.createVariant(media, resized, format, false)
+		if err != nil {
+			log.Printf("Failed to create %v variant of media %v: %v", width, media.ID, err)
+			continue
+		}
+		variants = append(variants, *variant)
+
+		var webp bytes.Buffer
+		if err = imaging.Encode(&webp, resized, imaging.WebP); err != nil {
+			log.Printf("Failed to encode %v WebP variant of media %v: %v", width, media.ID, err)
+			continue
+		}
+		if webp.Len() >= len(fallback) {
+			continue
+		}
+
+		variant, err = h.storeVariant(media, resized.Bounds(), imaging.WebP, webp.Bytes(), false)
+		if err != nil {
+			log.Printf("Failed to create %v WebP variant of media %v: %v", width, media.ID, err)
+			continue
+		}
+		variants = append(variants, *variant)
+	}
+
+	return variants
+}
+
+// createVariant stores img as a variant of media and returns it along with
+// the encoded file.
+func (h *Handler) createVariant(
+	media models.Media,
+	img image.Image,
+	format imaging.Format,
+	onDemand bool,
+) (*models.MediaVariant, []byte, error) {
+	var body bytes.Buffer
+	if err := imaging.Encode(&body, img, format); err != nil {
+		return nil, nil, err
+	}
+
+	variant, err := h.storeVariant(media, img.Bounds(), format, body.Bytes(), onDemand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return variant, body.Bytes(), nil
+}
+
+// storeVariant stores body, an image of bounds encoded in format, as a
+// variant of media.
+func (h *Handler) storeVariant(
+	media models.Media,
+	bounds image.Rectangle,
+	format imaging.Format,
+	body []byte,
+	onDemand bool,
+) (*models.MediaVariant, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	name := imaging.VariantName(bounds.Dx(), format)
+	variant := &models.MediaVariant{
+		ID:         id.String(),
+		MediaID:    media.ID,
+		Name:       name,
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		MimeType:   format.MimeType,
+		StorageKey: media.StorageKey + "-" + name,
+		OnDemand:   onDemand,
+		CreatedAt:  time.Now(),
+	}
+
+	variant.Size, err = h.files.Put(variant.StorageKey, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if err = h.store.CreateMediaVariant(*variant); err != nil {
+		return nil, err
+	}
+
+	return variant, nil
+}
+
+// serveFile streams a stored file. Stored files never change under their
+// key, so they can be cached for good.
+func (h *Handler) serveFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	key, mimeType string,
+	size int64,
+	etag string,
+	lastModified time.Time,
+) {
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if helpers.CheckNotModified(w, r, etag, lastModified) {
+		return
+	}
+
+	file, err := h.files.Open(key)
+	if err != nil {
+		if errors.Is(err, filestore.ErrNotFound) {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Media not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+}
+
+func getUserIDAndSiteID(r *http.Request) (string, string, error) {
+	userID := r.Context().Value("userID").(string)
+	siteID := mux.Vars(r)["siteID"]
+
+	if userID == "" {
+		return userID, siteID, errors.New("User not found")
+	}
+
+	if siteID == "" {
+		return userID, siteID, errors.New("Site not found")
+	}
+
+	return userID, siteID, nil
+}
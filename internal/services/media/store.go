@@ -0,0 +1,420 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+)
+
+var ErrQuotaExceeded = errors.New("Storage quota exceeded")
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getStorageQuota is the quota of the user's active plan, or
+// MEDIA_FREE_QUOTA_BYTES when they have no active subscription.
+func getStorageQuota(ctx context.Context, db queryRower, userID string) (int64, error) {
+	var quota int64
+	query := `
+		SELECT p.storage_quota_bytes
+		FROM subscriptions s
+		INNER JOIN plans p
+		ON s.plan_id = p.id
+		WHERE s.user_id = $1 AND s.end_date > $2
+	`
+	err := db.QueryRowContext(ctx, query, userID, time.Now()).Scan(&quota)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return int64(helpers.IntFromEnv("MEDIA_FREE_QUOTA_BYTES", 100<<20)), nil
+		}
+		return 0, err
+	}
+
+	return quota, nil
+}
+
+// getStorageUsed adds up the user's files and their resized variants.
+func getStorageUsed(ctx context.Context, db queryRower, userID string) (int64, error) {
+	var used int64
+	query := `
+		SELECT
+			COALESCE((SELECT SUM(size_bytes) FROM media WHERE user_id = $1), 0) +
+			COALESCE((
+				SELECT SUM(v.size_bytes)
+				FROM media_variants v
+				INNER JOIN media m
+				ON v.media_id = m.id
+				WHERE m.user_id = $1
+			), 0)
+	`
+	if err := db.QueryRowContext(ctx, query, userID).Scan(&used); err != nil {
+		return 0, err
+	}
+
+	return used, nil
+}
+
+// CreateMedia records an uploaded file on a site of the user. It returns
+// sql.ErrNoRows when the user does not own the site and ErrQuotaExceeded when
+// the file does not fit in their plan.
+func (s *Store) CreateMedia(media models.Media) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// uploads of the same user are checked against the quota one at a time
+	lock := `SELECT pg_advisory_xact_lock(hashtext($1))`
+	if _, err = tx.ExecContext(ctx, lock, media.UserID); err != nil {
+		return err
+	}
+
+	stmt := `
+		INSERT INTO media
+			(id, user_id, site_id, filename, mime_type, size_bytes, checksum, storage_key, created_at,
+			width, height)
+		SELECT $1, $2, id, $3, $4, $5, $6, $7, $8, $10, $11
+		FROM sites
+		WHERE id = $9 AND user_id = $2 AND deleted_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, stmt,
+		media.ID,
+		media.UserID,
+		media.Filename,
+		media.MimeType,
+		media.Size,
+		media.Checksum,
+		media.StorageKey,
+		media.CreatedAt,
+		media.SiteID,
+		media.Width,
+		media.Height,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	quota, err := getStorageQuota(ctx, tx, media.UserID)
+	if err != nil {
+		return err
+	}
+	used, err := getStorageUsed(ctx, tx, media.UserID)
+	if err != nil {
+		return err
+	}
+	if used > quota {
+		return ErrQuotaExceeded
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const mediaColumns = `
+	id, user_id, site_id, filename, mime_type, size_bytes, checksum, storage_key, created_at,
+	width, height
+`
+
+func scanMedia(scan func(dest ...any) error) (models.Media, error) {
+	var media models.Media
+	err := scan(
+		&media.ID,
+		&media.UserID,
+		&media.SiteID,
+		&media.Filename,
+		&media.MimeType,
+		&media.Size,
+		&media.Checksum,
+		&media.StorageKey,
+		&media.CreatedAt,
+		&media.Width,
+		&media.Height,
+	)
+	return media, err
+}
+
+func (s *Store) GetMediaBySiteID(
+	siteID, userID string,
+	page pagination.Params,
+) ([]models.Media, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media
+		WHERE site_id = $1 AND user_id = $2
+	`
+	clause, args := page.Clause("created_at", "id", []any{siteID, userID})
+
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	defer rows.Close()
+
+	mediaList := []models.Media{}
+	for rows.Next() {
+		media, err := scanMedia(rows.Scan)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+		mediaList = append(mediaList, media)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	mediaList, nextPage := pagination.Trim(
+		mediaList,
+		page,
+		func(media models.Media) pagination.Cursor {
+			return pagination.Cursor{CreatedAt: media.CreatedAt, ID: media.ID}
+		},
+	)
+	return mediaList, nextPage, nil
+}
+
+// GetMediaByID looks up a file for serving. Files of trashed sites are not
+// served.
+func (s *Store) GetMediaByID(mediaID string) (*models.Media, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media
+		WHERE id = $1 AND site_id IN (SELECT id FROM sites WHERE deleted_at IS NULL)
+	`
+	media, err := scanMedia(s.db.QueryRowContext(ctx, query, mediaID).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+// DeleteMedia removes the record of a file and its variants and returns
+// them, so the caller can delete the files themselves.
+func (s *Store) DeleteMedia(mediaID, siteID, userID string) (*models.Media, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// read the variants first, deleting the media row cascades to them
+	query := `
+		SELECT ` + variantColumns + `
+		FROM media_variants
+		WHERE media_id = $1
+	`
+	rows, err := tx.QueryContext(ctx, query, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []models.MediaVariant
+	for rows.Next() {
+		variant, err := scanVariant(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt := `
+		DELETE FROM media
+		WHERE id = $1 AND site_id = $2 AND user_id = $3
+		RETURNING ` + mediaColumns
+	media, err := scanMedia(tx.QueryRowContext(ctx, stmt, mediaID, siteID, userID).Scan)
+	if err != nil {
+		return nil, err
+	}
+	media.Variants = variants
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &media, nil
+}
+
+func (s *Store) GetMediaUsage(userID string) (*models.MediaUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	quota, err := getStorageQuota(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := getStorageUsed(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MediaUsage{
+		UsedBytes:  used,
+		QuotaBytes: quota,
+	}, nil
+}
+
+const variantColumns = `
+	id, media_id, name, width, height, mime_type, size_bytes, storage_key, on_demand, created_at
+`
+
+func scanVariant(scan func(dest ...any) error) (models.MediaVariant, error) {
+	var variant models.MediaVariant
+	err := scan(
+		&variant.ID,
+		&variant.MediaID,
+		&variant.Name,
+		&variant.Width,
+		&variant.Height,
+		&variant.MimeType,
+		&variant.Size,
+		&variant.StorageKey,
+		&variant.OnDemand,
+		&variant.CreatedAt,
+	)
+	return variant, err
+}
+
+// CreateMediaVariant records a resized copy of a media file. Recording the
+// same variant twice keeps the first one, both requests wrote the same file.
+func (s *Store) CreateMediaVariant(variant models.MediaVariant) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO media_variants
+			(id, media_id, name, width, height, mime_type, size_bytes, storage_key, on_demand, created_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (media_id, name) DO NOTHING
+	`
+	_, err := s.db.ExecContext(ctx, stmt,
+		variant.ID,
+		variant.MediaID,
+		variant.Name,
+		variant.Width,
+		variant.Height,
+		variant.MimeType,
+		variant.Size,
+		variant.StorageKey,
+		variant.OnDemand,
+		variant.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetMediaVariant(mediaID, name string) (*models.MediaVariant, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + variantColumns + `
+		FROM media_variants
+		WHERE media_id = $1 AND name = $2
+	`
+	variant, err := scanVariant(s.db.QueryRowContext(ctx, query, mediaID, name).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &variant, nil
+}
+
+// GetDeletedFiles returns up to limit storage keys of media and variants
+// whose rows are gone, whether deleted here or by a cascade.
+func (s *Store) GetDeletedFiles(limit int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT storage_key
+		FROM deleted_media_files
+		ORDER BY deleted_at
+		LIMIT $1
+	`
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// ForgetDeletedFile is called once the file under key is deleted.
+func (s *Store) ForgetDeletedFile(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		DELETE FROM deleted_media_files
+		WHERE storage_key = $1
+	`
+	_, err := s.db.ExecContext(ctx, stmt, key)
+	return err
+}
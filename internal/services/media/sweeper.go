@@ -0,0 +1,50 @@
+package media
+
+import (
+	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/filestore"
+)
+
+const sweepBatchSize = 100
+
+// FileSweeper deletes the files of media rows that are gone. Purging sites
+// and deleting users removes media by cascade, which no handler sees, so a
+// trigger records the storage keys for the sweeper.
+type FileSweeper struct {
+	store *Store
+	files filestore.Store
+}
+
+func NewFileSweeper(store *Store, files filestore.Store) *FileSweeper {
+	return &FileSweeper{
+		store: store,
+		files: files,
+	}
+}
+
+// PurgeTrash deletes every recorded file. Nothing can reach a file once its
+// row is gone, so there is no retention to wait out and before is unused.
+func (s *FileSweeper) PurgeTrash(before time.Time) (int64, error) {
+	var purged int64
+	for {
+		keys, err := s.store.GetDeletedFiles(sweepBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, key := range keys {
+			if err = s.files.Delete(key); err != nil {
+				return purged, err
+			}
+			if err = s.store.ForgetDeletedFile(key); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(keys) < sweepBatchSize {
+			return purged, nil
+		}
+	}
+}
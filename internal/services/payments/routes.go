@@ -14,6 +14,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
 	"github.com/mznrasil/my-blogs-be/internal/models"
 )
 
@@ -28,8 +29,10 @@ func NewHandler(store models.PaymentStore) *Handler {
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/payment/initiate", h.InitiatePayment).Methods(http.MethodPost)
-	router.HandleFunc("/payment", h.UpdatePayment).Methods(http.MethodPatch)
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/payment/initiate", h.InitiatePayment).Methods(http.MethodPost)
+	authRouter.HandleFunc("/payment", h.UpdatePayment).Methods(http.MethodPatch)
 }
 
 func (h *Handler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
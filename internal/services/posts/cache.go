@@ -0,0 +1,171 @@
+package posts
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mznrasil/my-blogs-be/internal/cache"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+)
+
+type cachedPostStore interface {
+	models.PostStore
+	models.PostScheduleStore
+}
+
+type sitePostsPage struct {
+	sitePosts *models.SitePosts
+	nextPage  pagination.Page
+}
+
+// CachedStore keeps the public reads of a site in memory. Entries are tagged
+// with the site's ID, so every write to its posts, the scheduler publishing
+// one and changes to the site itself drop them; the TTL bounds how stale
+// anything else that shows up in them, such as renamed tags, can get.
+type CachedStore struct {
+	cachedPostStore
+	sitePosts *cache.Cache[sitePostsPage]
+	posts     *cache.Cache[*models.Post]
+	versions  *cache.Cache[*models.SiteVersion]
+}
+
+func NewCachedStore(store cachedPostStore, size int, ttl time.Duration) *CachedStore {
+	return &CachedStore{
+		cachedPostStore: store,
+		sitePosts:       cache.New[sitePostsPage](size, ttl),
+		posts:           cache.New[*models.Post](size, ttl),
+		versions:        cache.New[*models.SiteVersion](size, ttl),
+	}
+}
+
+// InvalidateSite drops everything cached for the site.
+func (s *CachedStore) InvalidateSite(siteID string) {
+	s.sitePosts.Invalidate(siteID)
+	s.posts.Invalidate(siteID)
+	s.versions.Invalidate(siteID)
+}
+
+func (s *CachedStore) Stats() map[string]cache.Stats {
+	return map[string]cache.Stats{
+		"site_posts": s.sitePosts.Stats(),
+		"posts":      s.posts.Stats(),
+		"versions":   s.versions.Stats(),
+	}
+}
+
+// Cached values are shared between requests and handlers change what they
+// are given, so callers only ever get copies.
+
+func (s *CachedStore) GetAllSitePostsBySubdirectory(
+	subdirectory string,
+	page pagination.Params,
+) (*models.SitePosts, pagination.Page, error) {
+	key := fmt.Sprintf("%v\x00%d", subdirectory, page.Limit)
+	if page.After != nil {
+		key += "\x00" + pagination.Encode(*page.After)
+	}
+
+	cached, err := s.sitePosts.Get(key, func() (sitePostsPage, string, error) {
+		sitePosts, nextPage, err := s.cachedPostStore.GetAllSitePostsBySubdirectory(
+			subdirectory,
+			page,
+		)
+		if err != nil {
+			return sitePostsPage{}, "", err
+		}
+		return sitePostsPage{sitePosts: sitePosts, nextPage: nextPage}, sitePosts.Site.ID, nil
+	})
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	sitePosts := *cached.sitePosts
+	sitePosts.Posts = slices.Clone(sitePosts.Posts)
+	return &sitePosts, cached.nextPage, nil
+}
+
+func (s *CachedStore) GetAllSitePostsBySlug(subdirectory, slug string) (*models.Post, error) {
+	cached, err := s.posts.Get(subdirectory+"\x00"+slug, func() (*models.Post, string, error) {
+		post, err := s.cachedPostStore.GetAllSitePostsBySlug(subdirectory, slug)
+		if err != nil {
+			return nil, "", err
+		}
+		return post, post.SiteID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	post := *cached
+	return &post, nil
+}
+
+// GetSiteVersion is cached like the pages it validates, so a conditional GET
+// that comes back 304 costs no query.
+func (s *CachedStore) GetSiteVersion(subdirectory string) (*models.SiteVersion, error) {
+	cached, err := s.versions.Get(subdirectory, func() (*models.SiteVersion, string, error) {
+		version, err := s.cachedPostStore.GetSiteVersion(subdirectory)
+		if err != nil {
+			return nil, "", err
+		}
+		return version, version.SiteID, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	version := *cached
+	return &version, nil
+}
+
+func (s *CachedStore) CreatePost(newPost models.CreatePostPayload, userID, siteID string) error {
+	defer s.InvalidateSite(siteID)
+	return s.cachedPostStore.CreatePost(newPost, userID, siteID)
+}
+
+func (s *CachedStore) EditPost(
+	post models.CreatePostPayload,
+	postID, userID, siteID string,
+	version int,
+) error {
+	defer s.InvalidateSite(siteID)
+	return s.cachedPostStore.EditPost(post, postID, userID, siteID, version)
+}
+
+func (s *CachedStore) DeletePost(postID, siteID, userID string) error {
+	defer s.InvalidateSite(siteID)
+	return s.cachedPostStore.DeletePost(postID, siteID, userID)
+}
+
+func (s *CachedStore) RestorePost(postID, siteID, userID string) error {
+	defer s.InvalidateSite(siteID)
+	return s.cachedPostStore.RestorePost(postID, siteID, userID)
+}
+
+func (s *CachedStore) UpdatePostStatus(
+	postID, siteID, userID, status string,
+	publishedAt *time.Time,
+) error {
+	defer s.InvalidateSite(siteID)
+	return s.cachedPostStore.UpdatePostStatus(postID, siteID, userID, status, publishedAt)
+}
+
+func (s *CachedStore) RestorePostRevision(
+	revisionID, postID, siteID, userID string,
+	version int,
+) error {
+	defer s.InvalidateSite(siteID)
+	return s.cachedPostStore.RestorePostRevision(revisionID, postID, siteID, userID, version)
+}
+
+func (s *CachedStore) PublishDuePosts(now time.Time, limit int) ([]models.PublishEvent, error) {
+	events, err := s.cachedPostStore.PublishDuePosts(now, limit)
+	for _, event := range events {
+		if event.Error == "" {
+			s.InvalidateSite(event.SiteID)
+		}
+	}
+	return events, err
+}
@@ -4,24 +4,45 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 
+	"github.com/mznrasil/my-blogs-be/internal/diff"
+	"github.com/mznrasil/my-blogs-be/internal/document"
+	"github.com/mznrasil/my-blogs-be/internal/feeds"
 	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/markdown"
+	"github.com/mznrasil/my-blogs-be/internal/mergepatch"
 	"github.com/mznrasil/my-blogs-be/internal/middleware"
 	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+	"github.com/mznrasil/my-blogs-be/internal/preview"
+	"github.com/mznrasil/my-blogs-be/internal/render"
 )
 
 type Handler struct {
-	store models.PostStore
+	store              models.PostStore
+	subscriptionsStore models.SubscriptionStore
+	siteRedirects      models.SiteRedirectStore
 }
 
-func NewHandler(store models.PostStore) *Handler {
+func NewHandler(
+	store models.PostStore,
+	subscriptionsStore models.SubscriptionStore,
+	siteRedirects models.SiteRedirectStore,
+) *Handler {
 	return &Handler{
-		store: store,
+		store:              store,
+		subscriptionsStore: subscriptionsStore,
+		siteRedirects:      siteRedirects,
 	}
 }
 
@@ -29,13 +50,62 @@ func (h *Handler) RegisterRoutes(router *mux.Router) {
 	authRouter := router.NewRoute().Subrouter()
 	authRouter.Use(middleware.WithAuth)
 	authRouter.HandleFunc("/posts", h.GetAllPosts).Methods(http.MethodGet)
+	authRouter.HandleFunc("/posts/search", h.SearchPosts).Methods(http.MethodGet)
 	authRouter.HandleFunc("/{siteID}/posts", h.GetAllPostsBySiteID).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/posts/trash", h.GetTrashedPosts).Methods(http.MethodGet)
 	authRouter.HandleFunc("/{siteID}/posts/{postID}", h.GetPostByID).Methods(http.MethodGet)
 	authRouter.HandleFunc("/{siteID}/posts", h.CreatePost).Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/import", h.ImportPost).Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/export.md", h.ExportPost).
+		Methods(http.MethodGet)
 	authRouter.HandleFunc("/{siteID}/posts/{postID}", h.EditPost).Methods(http.MethodPatch)
 	authRouter.HandleFunc("/{siteID}/posts/{postID}", h.DeletePost).Methods(http.MethodDelete)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/restore", h.RestorePost).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/publish", h.PublishPost).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/unpublish", h.UnpublishPost).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/archive", h.ArchivePost).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/revisions", h.GetPostRevisions).
+		Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/revisions/diff", h.DiffPostRevisions).
+		Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/revisions/{revisionID}", h.GetPostRevision).
+		Methods(http.MethodGet)
+	authRouter.HandleFunc(
+		"/{siteID}/posts/{postID}/revisions/{revisionID}/restore",
+		h.RestorePostRevision,
+	).Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/previews", h.CreatePostPreview).
+		Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/previews", h.GetPostPreviews).
+		Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/posts/{postID}/previews/{previewID}", h.RevokePostPreview).
+		Methods(http.MethodDelete)
 
 	publicRouter := router.NewRoute().Subrouter()
+	publicRouter.Use(middleware.WithOptionalAuth)
+	publicRouter.HandleFunc("/preview/{token}", h.GetPreviewPost).Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/search", h.SearchSitePosts).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/tags", h.GetSiteTags).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/tags/{tag}", h.GetSitePostsByTag).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/categories", h.GetSiteCategories).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc(
+		"/posts/{subdirectory}/categories/{category}",
+		h.GetSitePostsByCategory,
+	).Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/feed.rss", h.GetSiteFeedRSS).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/feed.atom", h.GetSiteFeedAtom).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/posts/{subdirectory}/feed.json", h.GetSiteFeedJSON).
+		Methods(http.MethodGet)
 	publicRouter.HandleFunc("/posts/{subdirectory}", h.GetAllSitePostsBySubdirectory).
 		Methods(http.MethodGet)
 	publicRouter.HandleFunc("/posts/{subdirectory}/{slug}", h.GetAllSitePostsBySlug).
@@ -55,7 +125,22 @@ func (h *Handler) GetAllSitePostsBySlug(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "html" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Format must be json or html")
+		return
+	}
+
+	if _, done := h.checkSiteVersion(w, r, subdirectory); done {
+		return
+	}
+
 	post, err := h.store.GetAllSitePostsBySlug(subdirectory, slug)
+	if err == sql.ErrNoRows {
+		if h.redirectRenamedPost(w, r, subdirectory, slug) {
+			return
+		}
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			helpers.WriteJSONError(
@@ -74,7 +159,122 @@ func (h *Handler) GetAllSitePostsBySlug(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Posts fetched successfully", post)
+	if err = h.applyPaywall(r, post); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if format == "html" {
+		post.ContentHTML = render.HTML(post.ArticleContent)
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, helpers.APISuccess{
+		Data:    post,
+		Code:    http.StatusOK,
+		Message: "Posts fetched successfully",
+	})
+}
+
+// applyPaywall cuts a members-only post down to its first
+// PAYWALL_PREVIEW_BLOCKS blocks unless the reader wrote it or has an active
+// subscription.
+func (h *Handler) applyPaywall(r *http.Request, post *models.Post) error {
+	if !post.MembersOnly {
+		return nil
+	}
+
+	userID, _ := r.Context().Value("userID").(string)
+	if userID != "" {
+		if userID == post.UserID {
+			return nil
+		}
+
+		isActive, err := h.subscriptionsStore.CheckSubscriptionStatus(userID)
+		if err != nil {
+			return err
+		}
+		if isActive {
+			return nil
+		}
+	}
+
+	content, err := document.Decode(post.ArticleContent)
+	if err != nil {
+		return err
+	}
+
+	content, truncated := document.Truncate(
+		content,
+		helpers.IntFromEnv("PAYWALL_PREVIEW_BLOCKS", 3),
+	)
+	if !truncated {
+		return nil
+	}
+
+	// the word count and reading time still describe the full article, the
+	// table of contents only what the reader can see
+	post.ArticleContent = content
+	post.TableOfContents = render.Analyze(content).TableOfContents
+	post.Truncated = true
+	return nil
+}
+
+// redirectRenamedPost answers with a permanent redirect when slug is one a
+// published post used to have. It reports whether a response was written.
+func (h *Handler) redirectRenamedPost(
+	w http.ResponseWriter,
+	r *http.Request,
+	subdirectory, slug string,
+) bool {
+	currentSlug, err := h.store.GetCurrentSitePostSlug(subdirectory, slug)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			helpers.WriteJSONError(
+				w,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Server error: %v", err.Error()),
+			)
+			return true
+		}
+		return false
+	}
+
+	location := *r.URL
+	location.Path = strings.TrimSuffix(r.URL.Path, slug) + currentSlug
+	location.RawPath = ""
+	w.Header().Set("Location", helpers.APIBaseURL(r)+location.RequestURI())
+	helpers.WriteJSONSuccess(
+		w,
+		http.StatusMovedPermanently,
+		"Post has moved",
+		map[string]string{"slug": currentSlug},
+	)
+	return true
+}
+
+// writeSiteNotFound redirects to the same URL under the new subdirectory of
+// a site that gave up subdirectory, and otherwise answers 404. Only call it
+// when no live site has subdirectory.
+func (h *Handler) writeSiteNotFound(w http.ResponseWriter, r *http.Request, subdirectory string) {
+	currentSubdirectory, err := h.siteRedirects.GetCurrentSubdirectory(subdirectory)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			helpers.WriteJSONError(
+				w,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Server error: %v", err.Error()),
+			)
+			return
+		}
+		helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+		return
+	}
+
+	helpers.WriteSiteMoved(w, r, currentSubdirectory)
 }
 
 func (h *Handler) GetAllSitePostsBySubdirectory(w http.ResponseWriter, r *http.Request) {
@@ -84,7 +284,111 @@ func (h *Handler) GetAllSitePostsBySubdirectory(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	sitePosts, err := h.store.GetAllSitePostsBySubdirectory(subdirectory)
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, done := h.checkSiteVersion(w, r, subdirectory); done {
+		return
+	}
+
+	sitePosts, nextPage, err := h.store.GetAllSitePostsBySubdirectory(subdirectory, page)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSON(w, http.StatusOK, helpers.APISuccess{
+		Data:       sitePosts,
+		Code:       http.StatusOK,
+		Message:    "Site posts fetched successfully",
+		NextCursor: nextPage.NextCursor,
+		HasMore:    &nextPage.HasMore,
+	})
+}
+
+func (h *Handler) GetSiteFeedRSS(w http.ResponseWriter, r *http.Request) {
+	full, _ := strconv.ParseBool(r.URL.Query().Get("full"))
+	h.writeSiteFeed(w, r, "application/rss+xml; charset=utf-8", full, feeds.RSS)
+}
+
+func (h *Handler) GetSiteFeedAtom(w http.ResponseWriter, r *http.Request) {
+	full, _ := strconv.ParseBool(r.URL.Query().Get("full"))
+	h.writeSiteFeed(w, r, "application/atom+xml; charset=utf-8", full, feeds.Atom)
+}
+
+// GetSiteFeedJSON serves full articles as content_html, ?summary=true swaps
+// them for the descriptions. next_url keeps the query, so later pages stay in
+// the same mode.
+func (h *Handler) GetSiteFeedJSON(w http.ResponseWriter, r *http.Request) {
+	summary, _ := strconv.ParseBool(r.URL.Query().Get("summary"))
+	h.writeSiteFeed(w, r, "application/feed+json; charset=utf-8", !summary, feeds.JSON)
+}
+
+func (h *Handler) writeSiteFeed(
+	w http.ResponseWriter,
+	r *http.Request,
+	contentType string,
+	full bool,
+	encode func(feeds.Feed) ([]byte, error),
+) {
+	subdirectory := mux.Vars(r)["subdirectory"]
+	if subdirectory == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Subdirectory not provided")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	version, done := h.checkSiteVersion(w, r, subdirectory)
+	if done {
+		return
+	}
+
+	sitePosts, nextPage, err := h.store.GetAllSitePostsBySubdirectory(subdirectory, page)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	feed, err := h.siteFeed(r, subdirectory, sitePosts, nextPage, full)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	// a site without posts has been updated when it was
+	if feed.Updated.IsZero() {
+		feed.Updated = version.LastModified
+	}
+
+	body, err := encode(*feed)
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
@@ -94,7 +398,147 @@ func (h *Handler) GetAllSitePostsBySubdirectory(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Site posts fetched successfully", sitePosts)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// checkSiteVersion validates a conditional GET of a public page of a site
+// against the site's version, before anything of the page is loaded. It sets
+// the caching headers, returns the version and reports whether a response, a
+// 304 or an error, was written already. Signed in readers may see past the
+// paywall, so their copies are private.
+func (h *Handler) checkSiteVersion(
+	w http.ResponseWriter,
+	r *http.Request,
+	subdirectory string,
+) (*models.SiteVersion, bool) {
+	version, err := h.store.GetSiteVersion(subdirectory)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.writeSiteNotFound(w, r, subdirectory)
+			return nil, true
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return nil, true
+	}
+
+	etag, err := h.versionETag(r, version)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return nil, true
+	}
+
+	w.Header().Add("Vary", "X-User-Id")
+	if userID, _ := r.Context().Value("userID").(string); userID != "" {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", helpers.PublicCacheControl())
+	}
+	if helpers.CheckNotModified(w, r, etag, version.LastModified) {
+		return nil, true
+	}
+
+	return version, false
+}
+
+// versionETag derives the ETag of a public page from the site's version, the
+// exact URL and, for signed in readers, whether the paywall applies to them.
+func (h *Handler) versionETag(r *http.Request, version *models.SiteVersion) (string, error) {
+	reader := ""
+	if userID, _ := r.Context().Value("userID").(string); userID != "" {
+		isActive, err := h.subscriptionsStore.CheckSubscriptionStatus(userID)
+		if err != nil {
+			return "", err
+		}
+		reader = fmt.Sprintf("%v:%v", userID, isActive)
+	}
+
+	return helpers.ETag([]byte(version.Tag + "\x00" + r.URL.RequestURI() + "\x00" + reader)), nil
+}
+
+// siteFeed maps a page of published posts of a site onto a feed. Full
+// article bodies cost one query per post so they are only loaded on request.
+func (h *Handler) siteFeed(
+	r *http.Request,
+	subdirectory string,
+	sitePosts *models.SitePosts,
+	nextPage pagination.Page,
+	full bool,
+) (*feeds.Feed, error) {
+	feed := &feeds.Feed{
+		Title:       sitePosts.Site.Name,
+		Link:        helpers.SiteURL(subdirectory),
+		SelfLink:    feedPageURL(r, ""),
+		Description: fmt.Sprintf("Latest posts from %v", sitePosts.Site.Name),
+	}
+	if nextPage.HasMore {
+		feed.NextLink = feedPageURL(r, nextPage.NextCursor)
+	}
+
+	for _, post := range sitePosts.Posts {
+		published := post.CreatedAt
+		if post.PublishedAt != nil {
+			published = *post.PublishedAt
+		}
+		updated := post.UpdatedAt
+		if updated.Before(published) {
+			updated = published
+		}
+		if updated.After(feed.Updated) {
+			feed.Updated = updated
+		}
+
+		item := feeds.Item{
+			ID:          post.ID,
+			Title:       post.Title,
+			Link:        helpers.PostURL(subdirectory, post.Slug),
+			Description: post.SmallDescription,
+			Image:       post.Image,
+			Published:   published,
+			Updated:     updated,
+		}
+		if full {
+			fullPost, err := h.store.GetAllSitePostsBySlug(subdirectory, post.Slug)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+			if fullPost != nil {
+				if err = h.applyPaywall(r, fullPost); err != nil {
+					return nil, err
+				}
+				item.Content = render.HTML(fullPost.ArticleContent)
+			}
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
+
+// feedPageURL points at the current feed with the cursor swapped out, so
+// the first page keeps a stable feed URL and later pages chain via next_url.
+func feedPageURL(r *http.Request, cursor string) string {
+	feedURL, err := url.Parse(helpers.RequestURL(r))
+	if err != nil {
+		return helpers.RequestURL(r)
+	}
+
+	query := feedURL.Query()
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	feedURL.RawQuery = query.Encode()
+
+	return feedURL.String()
 }
 
 func (h *Handler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
@@ -104,22 +548,13 @@ func (h *Handler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var take int
-	takeParam := r.URL.Query().Get("take")
-	if takeParam != "" {
-		takeInt, err := strconv.Atoi(takeParam)
-		if err != nil {
-			helpers.WriteJSONError(
-				w,
-				http.StatusInternalServerError,
-				fmt.Sprintf("Failed to convert take to integer: %v", err.Error()),
-			)
-			return
-		}
-		take = takeInt
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	posts, err := h.store.GetAllPostsByUserID(userID, take)
+	posts, nextPage, err := h.store.GetAllPostsByUserID(userID, page)
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
@@ -129,7 +564,7 @@ func (h *Handler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Posts fetched successfully", posts)
+	helpers.WriteJSONPage(w, http.StatusOK, "Posts fetched successfully", posts, nextPage)
 }
 
 func (h *Handler) GetAllPostsBySiteID(w http.ResponseWriter, r *http.Request) {
@@ -139,7 +574,13 @@ func (h *Handler) GetAllPostsBySiteID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	posts, err := h.store.GetAllPostsByUserIDAndSiteID(userID, siteID)
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, nextPage, err := h.store.GetAllPostsByUserIDAndSiteID(userID, siteID, page)
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
@@ -149,7 +590,7 @@ func (h *Handler) GetAllPostsBySiteID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Posts fetched successfully", posts)
+	helpers.WriteJSONPage(w, http.StatusOK, "Posts fetched successfully", posts, nextPage)
 }
 
 func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
@@ -172,7 +613,11 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := h.store.GetPostBySlug(newPost.Slug, userID, siteID)
+	if !h.resolveSlug(w, newPost, siteID) {
+		return
+	}
+
+	taken, err := h.store.IsPostSlugTaken(newPost.Slug, siteID, "")
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
@@ -182,12 +627,27 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if post != nil {
+	if taken {
 		helpers.WriteJSONError(w, http.StatusConflict, "Post with this slug already exists")
 		return
 	}
 
 	if err = h.store.CreatePost(*newPost, userID, siteID); err != nil {
+		if errors.Is(err, ErrCategoryNotFound) {
+			helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	// the slug may have been generated, so hand the post back to the client
+	post, err := h.store.GetPostBySlug(newPost.Slug, userID, siteID)
+	if err != nil {
 		helpers.WriteJSONError(
 			w,
 			http.StatusInternalServerError,
@@ -196,7 +656,41 @@ func (h *Handler) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusCreated, "Post Created Successfully", nil)
+	helpers.WriteJSONSuccess(w, http.StatusCreated, "Post Created Successfully", post)
+}
+
+// resolveSlug generates a unique slug from the title when the payload has
+// none and rejects slugs reserved for public routes. It reports whether the
+// request can go on.
+func (h *Handler) resolveSlug(
+	w http.ResponseWriter,
+	post *models.CreatePostPayload,
+	siteID string,
+) bool {
+	if post.Slug != "" {
+		if isReservedSlug(post.Slug) {
+			helpers.WriteJSONError(
+				w,
+				http.StatusBadRequest,
+				fmt.Sprintf("Slug %q is reserved", post.Slug),
+			)
+			return false
+		}
+		return true
+	}
+
+	slug, err := h.store.GenerateUniquePostSlug(post.Title, siteID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return false
+	}
+	post.Slug = slug
+
+	return true
 }
 
 func (h *Handler) GetPostByID(w http.ResponseWriter, r *http.Request) {
@@ -227,6 +721,7 @@ func (h *Handler) GetPostByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("ETag", postETag(post.Version))
 	helpers.WriteJSONSuccess(w, http.StatusOK, "Post fetched successfully", post)
 }
 
@@ -242,20 +737,30 @@ func (h *Handler) EditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	postPayload := new(models.CreatePostPayload)
-	helpers.DecodeJSONBody(w, r, postPayload)
-
-	if err := helpers.Validate.Struct(postPayload); err != nil {
-		errors := err.(validator.ValidationErrors)
+	patch, err := mergepatch.Read(w, r)
+	if err != nil {
 		helpers.WriteJSONError(
 			w,
 			http.StatusBadRequest,
-			fmt.Sprintf("Invalid payload: %v", errors.Error()),
+			fmt.Sprintf("Invalid patch: %v", err.Error()),
+		)
+		return
+	}
+	fields, err := mergepatch.Fields(patch)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, mergepatch.ErrInvalidPatch.Error())
+		return
+	}
+	if err = mergepatch.RequireFields(patch, "title"); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid patch: %v", err.Error()),
 		)
 		return
 	}
 
-	post, err := h.store.GetPostBySlug(postPayload.Slug, userID, siteID)
+	post, err := h.store.GetPostByID(postID, siteID, userID)
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
@@ -270,31 +775,374 @@ func (h *Handler) EditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = h.store.EditPost(*postPayload, postID, userID, siteID); err != nil {
+	// "*" would let a client overwrite whatever version is current
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || strings.TrimSpace(ifMatch) == "*" {
 		helpers.WriteJSONError(
 			w,
-			http.StatusInternalServerError,
-			fmt.Sprintf("Server error: %v", err.Error()),
+			http.StatusPreconditionRequired,
+			"If-Match header with the post's ETag is required",
 		)
 		return
 	}
-
-	helpers.WriteJSONSuccess(w, http.StatusCreated, "Post Created Successfully", nil)
-}
-
-func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
-	userID, siteID, err := getUserIDAndSiteID(w, r)
-	if err != nil {
-		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+	if !helpers.IfMatch(ifMatch, postETag(post.Version)) {
+		writeVersionConflict(w, post.Version)
 		return
 	}
-	postID := mux.Vars(r)["postID"]
+
+	// tags and category are left alone unless the patch mentions them, so
+	// they are not part of the document being patched
+	current := models.CreatePostPayload{
+		Title:            post.Title,
+		ArticleContent:   post.ArticleContent,
+		SmallDescription: post.SmallDescription,
+		Image:            post.Image,
+		Slug:             post.Slug,
+		MembersOnly:      post.MembersOnly,
+	}
+	postPayload := new(models.CreatePostPayload)
+	if err = mergepatch.Apply(current, patch, postPayload); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid patch: %v", err.Error()),
+		)
+		return
+	}
+	if fields["tags"] && postPayload.Tags == nil {
+		postPayload.Tags = []string{}
+	}
+	if fields["category_id"] && postPayload.CategoryID == nil {
+		noCategory := ""
+		postPayload.CategoryID = &noCategory
+	}
+
+	if err := helpers.Validate.Struct(postPayload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	// an empty slug keeps the current one; a new one must be free
+	if postPayload.Slug != "" && postPayload.Slug != post.Slug {
+		if isReservedSlug(postPayload.Slug) {
+			helpers.WriteJSONError(
+				w,
+				http.StatusBadRequest,
+				fmt.Sprintf("Slug %q is reserved", postPayload.Slug),
+			)
+			return
+		}
+
+		taken, err := h.store.IsPostSlugTaken(postPayload.Slug, siteID, postID)
+		if err != nil {
+			helpers.WriteJSONError(
+				w,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Server error: %v", err.Error()),
+			)
+			return
+		}
+		if taken {
+			helpers.WriteJSONError(w, http.StatusConflict, "Post with this slug already exists")
+			return
+		}
+	}
+
+	if err = h.store.EditPost(*postPayload, postID, userID, siteID, post.Version); err != nil {
+		if errors.Is(err, ErrCategoryNotFound) {
+			helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if errors.Is(err, ErrVersionConflict) {
+			h.writeCurrentVersionConflict(w, postID, siteID, userID)
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	post, err = h.store.GetPostByID(postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	w.Header().Set("ETag", postETag(post.Version))
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Post updated successfully", post)
+}
+
+func postETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+type versionConflictError struct {
+	helpers.APIError
+	Version int `json:"version"`
+}
+
+// writeVersionConflict tells an editor that the post moved on and which
+// version to reload.
+func writeVersionConflict(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", postETag(version))
+	helpers.WriteJSON(w, http.StatusPreconditionFailed, versionConflictError{
+		APIError: helpers.APIError{
+			Code:    http.StatusPreconditionFailed,
+			Message: ErrVersionConflict.Error(),
+		},
+		Version: version,
+	})
+}
+
+// writeCurrentVersionConflict reports a conflict found while saving, when the
+// version the client sent was already checked and has since been bumped.
+func (h *Handler) writeCurrentVersionConflict(
+	w http.ResponseWriter,
+	postID, siteID, userID string,
+) {
+	post, err := h.store.GetPostByID(postID, siteID, userID)
+	if err != nil || post == nil {
+		helpers.WriteJSONError(w, http.StatusPreconditionFailed, ErrVersionConflict.Error())
+		return
+	}
+
+	writeVersionConflict(w, post.Version)
+}
+
+func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
 	if postID == "" {
 		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
 		return
 	}
 
 	if err := h.store.DeletePost(postID, siteID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Post moved to trash", nil)
+}
+
+func (h *Handler) GetTrashedPosts(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	posts, nextPage, err := h.store.GetTrashedPosts(siteID, userID, page)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONPage(w, http.StatusOK, "Trashed posts fetched successfully", posts, nextPage)
+}
+
+func (h *Handler) RestorePost(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	if err := h.store.RestorePost(postID, siteID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found in trash")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Post restored successfully", nil)
+}
+
+func (h *Handler) PublishPost(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	payload := new(models.PublishPostPayload)
+	if r.ContentLength != 0 {
+		helpers.DecodeJSONBody(w, r, payload)
+	}
+
+	now := time.Now()
+	status := models.PostStatusPublished
+	publishedAt := now
+	if payload.PublishAt != nil && payload.PublishAt.After(now) {
+		status = models.PostStatusScheduled
+		publishedAt = payload.PublishAt.Local()
+	}
+
+	err = h.store.UpdatePostStatus(postID, siteID, userID, status, &publishedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if status == models.PostStatusScheduled {
+		helpers.WriteJSONSuccess(w, http.StatusOK, "Post scheduled successfully", nil)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Post published successfully", nil)
+}
+
+func (h *Handler) UnpublishPost(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	err = h.store.UpdatePostStatus(postID, siteID, userID, models.PostStatusDraft, nil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Post unpublished successfully", nil)
+}
+
+func (h *Handler) ArchivePost(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	post, err := h.store.GetPostByID(postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if post == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	// keep the original publish date so the archive still shows when it went live
+	err = h.store.UpdatePostStatus(
+		postID,
+		siteID,
+		userID,
+		models.PostStatusArchived,
+		post.PublishedAt,
+	)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Post archived successfully", nil)
+}
+
+func (h *Handler) GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	revisions, err := h.store.GetPostRevisions(postID, siteID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
 		helpers.WriteJSONError(
 			w,
 			http.StatusInternalServerError,
@@ -303,7 +1151,846 @@ func (h *Handler) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Post Deleted Successfully", nil)
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Revisions fetched successfully", revisions)
+}
+
+func (h *Handler) GetPostRevision(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	postID := vars["postID"]
+	revisionID := vars["revisionID"]
+	if postID == "" || revisionID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID or revision ID not found")
+		return
+	}
+
+	revision, err := h.store.GetPostRevision(revisionID, postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if revision == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Revision fetched successfully", revision)
+}
+
+// DiffPostRevisions compares revision ?from= with revision ?to=, or with the
+// current version of the post when to is omitted.
+func (h *Handler) DiffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	fromID := r.URL.Query().Get("from")
+	toID := r.URL.Query().Get("to")
+	if fromID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "From revision not provided")
+		return
+	}
+
+	from, err := h.store.GetPostRevision(fromID, postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if from == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "From revision not found")
+		return
+	}
+
+	result := models.PostRevisionDiff{
+		From: models.PostRevisionSummary{
+			ID:             from.ID,
+			RevisionNumber: from.RevisionNumber,
+			Title:          from.Title,
+			UserID:         from.UserID,
+			CreatedAt:      from.CreatedAt,
+		},
+	}
+	fromDocument := revisionDocument(
+		from.Title,
+		from.ArticleContent,
+		from.SmallDescription,
+		from.Image,
+		from.Slug,
+	)
+
+	var toDocument map[string]any
+	if toID != "" {
+		to, err := h.store.GetPostRevision(toID, postID, siteID, userID)
+		if err != nil {
+			helpers.WriteJSONError(
+				w,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Server error: %v", err.Error()),
+			)
+			return
+		}
+		if to == nil {
+			helpers.WriteJSONError(w, http.StatusNotFound, "To revision not found")
+			return
+		}
+
+		result.To = &models.PostRevisionSummary{
+			ID:             to.ID,
+			RevisionNumber: to.RevisionNumber,
+			Title:          to.Title,
+			UserID:         to.UserID,
+			CreatedAt:      to.CreatedAt,
+		}
+		toDocument = revisionDocument(
+			to.Title,
+			to.ArticleContent,
+			to.SmallDescription,
+			to.Image,
+			to.Slug,
+		)
+	} else {
+		post, err := h.store.GetPostByID(postID, siteID, userID)
+		if err != nil {
+			helpers.WriteJSONError(
+				w,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Server error: %v", err.Error()),
+			)
+			return
+		}
+		if post == nil {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+
+		toDocument = revisionDocument(
+			post.Title,
+			post.ArticleContent,
+			post.SmallDescription,
+			post.Image,
+			post.Slug,
+		)
+	}
+
+	result.Changes = diff.JSON(fromDocument, toDocument)
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Revision diff fetched successfully", result)
+}
+
+func (h *Handler) RestorePostRevision(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	postID := vars["postID"]
+	revisionID := vars["revisionID"]
+	if postID == "" || revisionID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID or revision ID not found")
+		return
+	}
+
+	post, err := h.store.GetPostByID(postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if post == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	// restoring overwrites the current content like an edit does, so it is
+	// held to the same If-Match rule
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || strings.TrimSpace(ifMatch) == "*" {
+		helpers.WriteJSONError(
+			w,
+			http.StatusPreconditionRequired,
+			"If-Match header with the post's ETag is required",
+		)
+		return
+	}
+	if !helpers.IfMatch(ifMatch, postETag(post.Version)) {
+		writeVersionConflict(w, post.Version)
+		return
+	}
+
+	revision, err := h.store.GetPostRevision(revisionID, postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if revision == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Revision not found")
+		return
+	}
+
+	// the old slug may have been taken by another post since
+	taken, err := h.store.IsPostSlugTaken(revision.Slug, siteID, postID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if taken {
+		helpers.WriteJSONError(w, http.StatusConflict, "Post with this slug already exists")
+		return
+	}
+
+	err = h.store.RestorePostRevision(revisionID, postID, siteID, userID, post.Version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Revision not found")
+			return
+		}
+		if errors.Is(err, ErrVersionConflict) {
+			h.writeCurrentVersionConflict(w, postID, siteID, userID)
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Revision restored successfully", nil)
+}
+
+const (
+	defaultPreviewTTL      = 72 * time.Hour
+	defaultPreviewMaxViews = 50
+)
+
+func (h *Handler) CreatePostPreview(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	if !preview.Enabled() {
+		helpers.WriteJSONError(w, http.StatusServiceUnavailable, preview.ErrNoSecret.Error())
+		return
+	}
+
+	payload := new(models.CreatePostPreviewPayload)
+	if r.ContentLength != 0 {
+		helpers.DecodeJSONBody(w, r, payload)
+	}
+
+	if err := helpers.Validate.Struct(payload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid Payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	ttl := defaultPreviewTTL
+	if payload.ExpiresInHours > 0 {
+		ttl = time.Duration(payload.ExpiresInHours) * time.Hour
+	}
+	maxViews := defaultPreviewMaxViews
+	if payload.MaxViews > 0 {
+		maxViews = payload.MaxViews
+	}
+	// tokens carry the expiry in whole seconds
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+
+	postPreview, err := h.store.CreatePostPreview(postID, siteID, userID, expiresAt, maxViews)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	postPreview.Token, err = preview.Sign(postPreview.ID, expiresAt)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	postPreview.URL = fmt.Sprintf(
+		"%v/preview/%v",
+		helpers.APIRootURL(r, fmt.Sprintf("/%v/posts/%v/previews", siteID, postID)),
+		postPreview.Token,
+	)
+
+	helpers.WriteJSONSuccess(w, http.StatusCreated, "Preview link created", postPreview)
+}
+
+func (h *Handler) GetPostPreviews(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not found")
+		return
+	}
+
+	previews, err := h.store.GetPostPreviews(postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Preview links fetched successfully", previews)
+}
+
+func (h *Handler) RevokePostPreview(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	vars := mux.Vars(r)
+	postID := vars["postID"]
+	previewID := vars["previewID"]
+	if postID == "" || previewID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID or preview ID not found")
+		return
+	}
+
+	if err := h.store.RevokePostPreview(previewID, postID, siteID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Preview link not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Preview link revoked", nil)
+}
+
+// GetPreviewPost serves a post through a preview link in the same shape as
+// GetAllSitePostsBySlug, whatever its status.
+func (h *Handler) GetPreviewPost(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "html" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Format must be json or html")
+		return
+	}
+
+	// drafts must not end up in shared caches or search results
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+
+	previewID, err := preview.Verify(mux.Vars(r)["token"], time.Now())
+	if err != nil {
+		switch err {
+		case preview.ErrNoSecret:
+			helpers.WriteJSONError(w, http.StatusServiceUnavailable, err.Error())
+		case preview.ErrExpiredToken:
+			helpers.WriteJSONError(w, http.StatusGone, err.Error())
+		default:
+			helpers.WriteJSONError(w, http.StatusNotFound, err.Error())
+		}
+		return
+	}
+
+	post, err := h.store.UsePostPreview(previewID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(
+				w,
+				http.StatusGone,
+				"Preview link was revoked or has reached its view limit",
+			)
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if format == "html" {
+		post.ContentHTML = render.HTML(post.ArticleContent)
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Posts fetched successfully", post)
+}
+
+// maxImportSize bounds uploaded Markdown files, which are plain text and
+// rarely more than a few hundred kilobytes.
+const maxImportSize = 2 << 20
+
+func (h *Handler) ImportPost(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	source, err := readMarkdownUpload(w, r)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid file: %v", err.Error()),
+		)
+		return
+	}
+
+	matter, body, err := markdown.SplitFrontMatter(source)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if matter.Title == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Front matter must include a title")
+		return
+	}
+
+	newPost := models.CreatePostPayload{
+		Title:            matter.Title,
+		ArticleContent:   markdown.Parse(body),
+		SmallDescription: matter.Description,
+		Image:            matter.Image,
+		Slug:             matter.Slug,
+	}
+	if !h.resolveSlug(w, &newPost, siteID) {
+		return
+	}
+
+	taken, err := h.store.IsPostSlugTaken(newPost.Slug, siteID, "")
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if taken {
+		helpers.WriteJSONError(w, http.StatusConflict, "Post with this slug already exists")
+		return
+	}
+
+	if err = h.store.CreatePost(newPost, userID, siteID); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	post, err := h.store.GetPostBySlug(newPost.Slug, userID, siteID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusCreated, "Post imported successfully", post)
+}
+
+// readMarkdownUpload accepts either a multipart form with a "file" field or
+// the Markdown itself as the request body.
+func readMarkdownUpload(w http.ResponseWriter, r *http.Request) (string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var reader io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	source, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	if !utf8.Valid(source) {
+		return "", errors.New("Markdown must be UTF-8 encoded")
+	}
+
+	return string(source), nil
+}
+
+func (h *Handler) ExportPost(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(w, r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	postID := mux.Vars(r)["postID"]
+	if postID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Post ID not specified")
+		return
+	}
+
+	post, err := h.store.GetPostByID(postID, siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if post == nil {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Post not found")
+		return
+	}
+
+	content, err := document.Decode(post.ArticleContent)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	matter := markdown.FrontMatter{
+		Title:       post.Title,
+		Slug:        post.Slug,
+		Description: post.SmallDescription,
+		Image:       post.Image,
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set(
+		"Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%v.md"`, post.Slug),
+	)
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, matter.String()+"\n"+markdown.Write(content))
+}
+
+func revisionDocument(
+	title string,
+	articleContent any,
+	smallDescription, image, slug string,
+) map[string]any {
+	return map[string]any{
+		"title":             title,
+		"article_content":   articleContent,
+		"small_description": smallDescription,
+		"image":             image,
+		"slug":              slug,
+	}
+}
+
+func (h *Handler) SearchPosts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(string)
+	if userID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "User ID not found.")
+		return
+	}
+
+	query, limit, err := getSearchParams(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, err := h.store.SearchPostsByUserID(userID, query, limit)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Posts searched successfully", results)
+}
+
+func (h *Handler) SearchSitePosts(w http.ResponseWriter, r *http.Request) {
+	subdirectory := mux.Vars(r)["subdirectory"]
+	if subdirectory == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Subdirectory not provided")
+		return
+	}
+
+	query, limit, err := getSearchParams(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, done := h.checkSiteVersion(w, r, subdirectory); done {
+		return
+	}
+
+	// like the paywall, members-only posts are searched in full for their
+	// author and subscribers only
+	readerID, _ := r.Context().Value("userID").(string)
+	subscribed := false
+	if readerID != "" {
+		subscribed, err = h.subscriptionsStore.CheckSubscriptionStatus(readerID)
+		if err != nil {
+			helpers.WriteJSONError(
+				w,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Server error: %v", err.Error()),
+			)
+			return
+		}
+	}
+
+	results, err := h.store.SearchSitePosts(subdirectory, query, limit, readerID, subscribed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	// snippets would quote members-only posts past their preview
+	for i := range results {
+		if results[i].MembersOnly {
+			results[i].Snippet = ""
+		}
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Posts searched successfully", results)
+}
+
+func (h *Handler) GetSiteTags(w http.ResponseWriter, r *http.Request) {
+	subdirectory := mux.Vars(r)["subdirectory"]
+	if subdirectory == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Subdirectory not provided")
+		return
+	}
+
+	if _, done := h.checkSiteVersion(w, r, subdirectory); done {
+		return
+	}
+
+	tags, err := h.store.GetSiteTags(subdirectory)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Tags fetched successfully", tags)
+}
+
+func (h *Handler) GetSiteCategories(w http.ResponseWriter, r *http.Request) {
+	subdirectory := mux.Vars(r)["subdirectory"]
+	if subdirectory == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Subdirectory not provided")
+		return
+	}
+
+	if _, done := h.checkSiteVersion(w, r, subdirectory); done {
+		return
+	}
+
+	categories, err := h.store.GetSiteCategories(subdirectory)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Categories fetched successfully", categories)
+}
+
+func (h *Handler) GetSitePostsByTag(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subdirectory := vars["subdirectory"]
+	tag := vars["tag"]
+	if subdirectory == "" || tag == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Subdirectory or tag not provided")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, done := h.checkSiteVersion(w, r, subdirectory); done {
+		return
+	}
+
+	topicPosts, nextPage, err := h.store.GetSitePostsByTag(subdirectory, tag, page)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Tag not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONPage(
+		w,
+		http.StatusOK,
+		"Tag posts fetched successfully",
+		topicPosts,
+		nextPage,
+	)
+}
+
+func (h *Handler) GetSitePostsByCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subdirectory := vars["subdirectory"]
+	category := vars["category"]
+	if subdirectory == "" || category == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Subdirectory or category not provided")
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, done := h.checkSiteVersion(w, r, subdirectory); done {
+		return
+	}
+
+	topicPosts, nextPage, err := h.store.GetSitePostsByCategory(subdirectory, category, page)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Category not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONPage(
+		w,
+		http.StatusOK,
+		"Category posts fetched successfully",
+		topicPosts,
+		nextPage,
+	)
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+func getSearchParams(r *http.Request) (string, int, error) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		return "", 0, errors.New("Search query not provided")
+	}
+
+	limit := defaultSearchLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		limitInt, err := strconv.Atoi(limitParam)
+		if err != nil || limitInt < 1 {
+			return "", 0, errors.New("Limit must be a positive integer")
+		}
+		limit = min(limitInt, maxSearchLimit)
+	}
+
+	return query, limit, nil
 }
 
 func getUserIDAndSiteID(_ http.ResponseWriter, r *http.Request) (string, string, error) {
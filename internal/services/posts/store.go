@@ -5,13 +5,112 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/imaging"
 	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+	"github.com/mznrasil/my-blogs-be/internal/render"
 )
 
+var (
+	ErrCategoryNotFound = errors.New("Category not found")
+	ErrVersionConflict  = errors.New("Post was changed by someone else")
+)
+
+// reservedSlugs are the public routes that sit next to
+// /posts/{subdirectory}/{slug} and would hide a post with the same slug.
+var reservedSlugs = map[string]bool{
+	"search":     true,
+	"tags":       true,
+	"categories": true,
+	"feed.rss":   true,
+	"feed.atom":  true,
+	"feed.json":  true,
+}
+
+func isReservedSlug(slug string) bool {
+	return reservedSlugs[slug]
+}
+
+const postTaxonomyColumns = `
+	(
+		SELECT COALESCE(json_agg(json_build_object('name', t.name, 'slug', t.slug) ORDER BY t.name), '[]')
+		FROM post_tags pt
+		INNER JOIN tags t
+		ON pt.tag_id = t.id
+		WHERE pt.post_id = posts.id
+	),
+	(
+		SELECT json_build_object('name', c.name, 'slug', c.slug)
+		FROM categories c
+		WHERE c.id = posts.category_id
+	)
+`
+
+// postColumns are the columns scanPost reads. The taxonomy subqueries expect
+// the posts table to be unaliased.
+const postColumns = `
+	id, title, article_content, small_description, image, slug, status, published_at, created_at,
+	updated_at, user_id, site_id, category_id, word_count, reading_time, table_of_contents, version,
+	members_only, media_image_set(image),
+` + postTaxonomyColumns
+
+func scanPost(row *sql.Row) (*models.Post, error) {
+	post := new(models.Post)
+	var marshalledArticleContent, marshalledTableOfContents, marshalledTags, marshalledCategory []byte
+	var imageSet []byte
+	err := row.Scan(
+		&post.ID,
+		&post.Title,
+		&marshalledArticleContent,
+		&post.SmallDescription,
+		&post.Image,
+		&post.Slug,
+		&post.Status,
+		&post.PublishedAt,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.UserID,
+		&post.SiteID,
+		&post.CategoryID,
+		&post.WordCount,
+		&post.ReadingTime,
+		&marshalledTableOfContents,
+		&post.Version,
+		&post.MembersOnly,
+		&imageSet,
+		&marshalledTags,
+		&marshalledCategory,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(marshalledArticleContent, &post.ArticleContent); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(marshalledTableOfContents, &post.TableOfContents); err != nil {
+		return nil, err
+	}
+
+	if err = unmarshalPostTaxonomy(post, marshalledTags, marshalledCategory); err != nil {
+		return nil, err
+	}
+
+	if post.ImageSet, err = imaging.NewImageSet(post.Image, imageSet); err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
 type Store struct {
 	db *sql.DB
 }
@@ -29,7 +128,7 @@ func (s *Store) GetAllSitePostsBySlug(subdirectory, slug string) (*models.Post,
 	var siteID string
 	query := `
     SELECT id FROM sites
-    WHERE subdirectory = $1
+    WHERE subdirectory = $1 AND deleted_at IS NULL
   `
 	err := s.db.QueryRowContext(ctx, query, subdirectory).Scan(&siteID)
 	if err != nil {
@@ -37,147 +136,196 @@ func (s *Store) GetAllSitePostsBySlug(subdirectory, slug string) (*models.Post,
 	}
 
 	query = `
-    SELECT id, title, article_content, small_description, image, slug, created_at, updated_at, user_id, site_id
+    SELECT ` + postColumns + `
     FROM posts
-    WHERE slug = $1 AND site_id = $2
+    WHERE slug = $1 AND site_id = $2 AND status = 'published' AND published_at <= $3
+      AND deleted_at IS NULL
   `
-	post := new(models.Post)
-	var marshalledArticleContent []byte
-	err = s.db.QueryRowContext(ctx, query, slug, siteID).Scan(
-		&post.ID,
-		&post.Title,
-		&marshalledArticleContent,
-		&post.SmallDescription,
-		&post.Image,
-		&post.Slug,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-		&post.UserID,
-		&post.SiteID,
-	)
+	post, err := scanPost(s.db.QueryRowContext(ctx, query, slug, siteID, time.Now()))
 	if err != nil {
 		return nil, err
 	}
 
-	if err = json.Unmarshal(marshalledArticleContent, &post.ArticleContent); err != nil {
-		return nil, err
-	}
-
 	return post, nil
 }
 
-func (s *Store) GetAllSitePostsBySubdirectory(subdirectory string) (*models.SitePosts, error) {
+// GetSiteVersion reads the published posts, topics and image variants of a
+// site in aggregate. Deleting a post or topic lowers a count, every other
+// change raises a max(updated_at), so the tag moves with each of them. The
+// last modification is the latest timestamp of the site and anything of it,
+// unpublished and trashed posts included, so it never goes back.
+func (s *Store) GetSiteVersion(subdirectory string) (*models.SiteVersion, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	site := new(models.SiteName)
 	query := `
-    SELECT id, name FROM sites
-    WHERE subdirectory = $1
-  `
-	err := s.db.QueryRowContext(ctx, query, subdirectory).Scan(&site.ID, &site.Name)
+		SELECT
+			s.id,
+			GREATEST(
+				COALESCE(s.updated_at, s.created_at), s.content_deleted_at,
+				m.updated_at, m.deleted_at, m.published_at,
+				t.updated_at, c.updated_at
+			),
+			concat_ws(
+				'/',
+				COALESCE(s.updated_at, s.created_at),
+				p.count, p.updated_at,
+				t.count, t.updated_at,
+				c.count, c.updated_at,
+				v.count
+			)
+		FROM sites s
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS count, MAX(updated_at) AS updated_at
+			FROM posts
+			WHERE site_id = s.id AND status = 'published' AND published_at <= $2
+				AND deleted_at IS NULL
+		) p
+		CROSS JOIN LATERAL (
+			SELECT
+				MAX(updated_at) AS updated_at,
+				MAX(deleted_at) AS deleted_at,
+				MAX(published_at) FILTER (WHERE published_at <= $2) AS published_at
+			FROM posts
+			WHERE site_id = s.id
+		) m
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS count, MAX(updated_at) AS updated_at
+			FROM tags
+			WHERE site_id = s.id
+		) t
+		CROSS JOIN LATERAL (
+			SELECT COUNT(*) AS count, MAX(updated_at) AS updated_at
+			FROM categories
+			WHERE site_id = s.id
+		) c
+		CROSS JOIN LATERAL (
+			SELECT COUNT(v.id) AS count
+			FROM posts p
+			INNER JOIN media_variants v
+			ON v.media_id = substring(p.image FROM '/media/([0-9a-f-]{36})/') AND NOT v.on_demand
+			WHERE p.site_id = s.id AND p.status = 'published' AND p.deleted_at IS NULL
+		) v
+		WHERE s.subdirectory = $1 AND s.deleted_at IS NULL
+	`
+
+	version := new(models.SiteVersion)
+	err := s.db.QueryRowContext(ctx, query, subdirectory, time.Now()).Scan(
+		&version.SiteID,
+		&version.LastModified,
+		&version.Tag,
+	)
 	if err != nil {
 		return nil, err
 	}
 
-	query = `
-    SELECT id, title, small_description, image, slug, created_at
+	return version, nil
+}
+
+func (s *Store) GetAllSitePostsBySubdirectory(
+	subdirectory string,
+	page pagination.Params,
+) (*models.SitePosts, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	site, err := s.getSiteName(ctx, subdirectory)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	query := `
+    SELECT id, title, small_description, image, slug, published_at, created_at, updated_at,
+      word_count, reading_time, members_only, media_image_set(image)
     FROM posts
-    WHERE site_id = $1
-    ORDER BY created_at DESC;
+    WHERE site_id = $1 AND status = 'published' AND published_at <= $2 AND deleted_at IS NULL
   `
-	rows, err := s.db.QueryContext(ctx, query, site.ID)
+	clause, args := page.Clause("created_at", "id", []any{site.ID, time.Now()})
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
 	defer rows.Close()
 
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		rows.Scan(
-			&post.ID,
-			&post.Title,
-			&post.SmallDescription,
-			&post.Image,
-			&post.Slug,
-			&post.CreatedAt,
-		)
-		posts = append(posts, post)
-	}
-	if err := rows.Err(); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+	posts, err := scanPublicPostSummaries(rows)
+	if err != nil {
+		return nil, pagination.Page{}, err
 	}
 
+	posts, nextPage := pagination.Trim(posts, page, postCursor)
 	return &models.SitePosts{
 		Site:  *site,
 		Posts: posts,
-	}, nil
+	}, nextPage, nil
 }
 
-func (s *Store) GetAllPostsByUserID(userID string, take int) ([]models.Post, error) {
+func (s *Store) GetAllPostsByUserID(
+	userID string,
+	page pagination.Params,
+) ([]models.Post, pagination.Page, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var args []interface{}
-
 	query := `
-	    SELECT id, title, small_description, image, slug, created_at, user_id, site_id
+	    SELECT id, title, small_description, image, slug, status, published_at, created_at, user_id, site_id
 	    FROM posts
-	    WHERE user_id = $1
-	    ORDER BY created_at DESC
+	    WHERE user_id = $1 AND deleted_at IS NULL
 	`
-	args = append(args, userID)
-
-	if take != 0 {
-		query += `LIMIT $2`
-		args = append(args, take)
-	}
+	clause, args := page.Clause("created_at", "id", []any{userID})
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
 	if err != nil {
-		return nil, err
+		return nil, pagination.Page{}, err
 	}
 	defer rows.Close()
 
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
-		rows.Scan(
+		err := rows.Scan(
 			&post.ID,
 			&post.Title,
 			&post.SmallDescription,
 			&post.Image,
 			&post.Slug,
+			&post.Status,
+			&post.PublishedAt,
 			&post.CreatedAt,
 			&post.UserID,
 			&post.SiteID,
 		)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
 		posts = append(posts, post)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, pagination.Page{}, err
 	}
 
-	return posts, nil
+	posts, nextPage := pagination.Trim(posts, page, postCursor)
+	return posts, nextPage, nil
 }
 
-func (s *Store) GetAllPostsByUserIDAndSiteID(userID, siteID string) (*models.PostSite, error) {
+func (s *Store) GetAllPostsByUserIDAndSiteID(
+	userID, siteID string,
+	page pagination.Params,
+) (*models.PostSite, pagination.Page, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	query := `
-    SELECT p.id, p.title, p.image, p.created_at, s.id, s.subdirectory
+    SELECT p.id, p.title, p.image, p.status, p.published_at, p.created_at, s.id, s.subdirectory
     FROM posts p
     LEFT JOIN sites s
     ON p.site_id = s.id
-    WHERE p.user_id = $1 AND p.site_id = $2
-    ORDER BY created_at DESC;
+    WHERE p.user_id = $1 AND p.site_id = $2 AND p.deleted_at IS NULL
   `
+	clause, args := page.Clause("p.created_at", "p.id", []any{userID, siteID})
 
-	rows, err := s.db.QueryContext(ctx, query, userID, siteID)
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
 	if err != nil {
-		return nil, err
+		return nil, pagination.Page{}, err
 	}
 	defer rows.Close()
 
@@ -185,24 +333,38 @@ func (s *Store) GetAllPostsByUserIDAndSiteID(userID, siteID string) (*models.Pos
 	site := new(models.SiteSubdirectory)
 	for rows.Next() {
 		var post models.PostSummary
-		rows.Scan(
+		err := rows.Scan(
 			&post.ID,
 			&post.Title,
 			&post.Image,
+			&post.Status,
+			&post.PublishedAt,
 			&post.CreatedAt,
 			&site.ID,
 			&site.Subdirectory,
 		)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
 		posts = append(posts, post)
 	}
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, pagination.Page{}, err
 	}
 
+	posts, nextPage := pagination.Trim(posts, page, postSummaryCursor)
 	return &models.PostSite{
 		Posts: posts,
 		Site:  *site,
-	}, nil
+	}, nextPage, nil
+}
+
+func postCursor(post models.Post) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
+}
+
+func postSummaryCursor(post models.PostSummary) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: post.CreatedAt, ID: post.ID}
 }
 
 func (s *Store) CreatePost(newPost models.CreatePostPayload, userID, siteID string) error {
@@ -211,9 +373,10 @@ func (s *Store) CreatePost(newPost models.CreatePostPayload, userID, siteID stri
 
 	stmt := `
 		INSERT INTO posts
-			(id, title, article_content, small_description, image, slug, created_at, updated_at, user_id, site_id)
+			(id, title, article_content, small_description, image, slug, created_at, updated_at, user_id, site_id,
+			word_count, reading_time, table_of_contents, members_only)
 		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
 
 	uuid, err := uuid.NewV7()
@@ -221,7 +384,19 @@ func (s *Store) CreatePost(newPost models.CreatePostPayload, userID, siteID stri
 		return err
 	}
 
-	_, err = s.db.ExecContext(ctx, stmt,
+	stats := render.Analyze(newPost.ArticleContent)
+	marshalledTableOfContents, err := json.Marshal(stats.TableOfContents)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, stmt,
 		uuid,
 		&newPost.Title,
 		&newPost.ArticleContent,
@@ -232,11 +407,31 @@ func (s *Store) CreatePost(newPost models.CreatePostPayload, userID, siteID stri
 		time.Now(),
 		userID,
 		siteID,
+		stats.WordCount,
+		stats.ReadingTime,
+		marshalledTableOfContents,
+		newPost.MembersOnly,
 	)
 	if err != nil {
 		return err
 	}
 
+	if err = claimPostSlug(ctx, tx, newPost.Slug, siteID); err != nil {
+		return err
+	}
+
+	if err = setPostTaxonomy(ctx, tx, newPost, uuid.String(), siteID); err != nil {
+		return err
+	}
+
+	if err = insertPostRevision(ctx, tx, newPost, uuid.String(), userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -245,26 +440,13 @@ func (s *Store) GetPostBySlug(slug, userID, siteID string) (*models.Post, error)
 	defer cancel()
 
 	query := `
-		SELECT id, title, article_content, small_description, image, slug, created_at, updated_at, user_id, site_id
+		SELECT ` + postColumns + `
 		FROM posts
-		WHERE slug = $1 AND user_id = $2 AND site_id = $3
+		WHERE slug = $1 AND user_id = $2 AND site_id = $3 AND deleted_at IS NULL
 		ORDER BY created_at DESC;
 	`
 
-	post := new(models.Post)
-	var marshalledArticleContent []byte
-	err := s.db.QueryRowContext(ctx, query, slug, userID, siteID).Scan(
-		&post.ID,
-		&post.Title,
-		&marshalledArticleContent,
-		&post.SmallDescription,
-		&post.Image,
-		&post.Slug,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-		&post.UserID,
-		&post.SiteID,
-	)
+	post, err := scanPost(s.db.QueryRowContext(ctx, query, slug, userID, siteID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -272,10 +454,6 @@ func (s *Store) GetPostBySlug(slug, userID, siteID string) (*models.Post, error)
 		return nil, err
 	}
 
-	if err = json.Unmarshal(marshalledArticleContent, &post.ArticleContent); err != nil {
-		return nil, err
-	}
-
 	return post, nil
 }
 
@@ -284,26 +462,13 @@ func (s *Store) GetPostByID(postID, siteID, userID string) (*models.Post, error)
 	defer cancel()
 
 	query := `
-		SELECT id, title, article_content, small_description, image, slug, created_at, updated_at, user_id, site_id
+		SELECT ` + postColumns + `
 		FROM posts
-		WHERE id = $1 AND site_id = $2 AND user_id = $3
+		WHERE id = $1 AND site_id = $2 AND user_id = $3 AND deleted_at IS NULL
 		ORDER BY created_at DESC;
 	`
 
-	post := new(models.Post)
-	var marshalledArticleContent []byte
-	err := s.db.QueryRowContext(ctx, query, postID, siteID, userID).Scan(
-		&post.ID,
-		&post.Title,
-		&marshalledArticleContent,
-		&post.SmallDescription,
-		&post.Image,
-		&post.Slug,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-		&post.UserID,
-		&post.SiteID,
-	)
+	post, err := scanPost(s.db.QueryRowContext(ctx, query, postID, siteID, userID))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -311,14 +476,16 @@ func (s *Store) GetPostByID(postID, siteID, userID string) (*models.Post, error)
 		return nil, err
 	}
 
-	if err = json.Unmarshal(marshalledArticleContent, &post.ArticleContent); err != nil {
-		return nil, err
-	}
-
 	return post, nil
 }
 
-func (s *Store) EditPost(post models.CreatePostPayload, postID, userID, siteID string) error {
+// EditPost saves a post if it is still at version, so an editor working on a
+// stale copy gets ErrVersionConflict instead of overwriting newer changes.
+func (s *Store) EditPost(
+	post models.CreatePostPayload,
+	postID, userID, siteID string,
+	version int,
+) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -329,6 +496,12 @@ func (s *Store) EditPost(post models.CreatePostPayload, postID, userID, siteID s
 	if foundPost == nil {
 		return errors.New("Post not found")
 	}
+	if foundPost.Version != version {
+		return ErrVersionConflict
+	}
+	if post.Slug == "" {
+		post.Slug = foundPost.Slug
+	}
 
 	stmt := `
 		UPDATE posts
@@ -342,12 +515,29 @@ func (s *Store) EditPost(post models.CreatePostPayload, postID, userID, siteID s
 			created_at = $7,
 			updated_at = $8,
 			user_id = $9,
-			site_id = $10
+			site_id = $10,
+			word_count = $11,
+			reading_time = $12,
+			table_of_contents = $13,
+			members_only = $14,
+			version = version + 1
 		WHERE
-			id = $1 AND user_id = $9 AND site_id = $10
+			id = $1 AND user_id = $9 AND site_id = $10 AND version = $15 AND deleted_at IS NULL
 	`
 
-	_, err = s.db.ExecContext(ctx, stmt,
+	stats := render.Analyze(post.ArticleContent)
+	marshalledTableOfContents, err := json.Marshal(stats.TableOfContents)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, stmt,
 		postID,
 		&post.Title,
 		&post.ArticleContent,
@@ -358,27 +548,1264 @@ func (s *Store) EditPost(post models.CreatePostPayload, postID, userID, siteID s
 		time.Now(),
 		userID,
 		siteID,
+		stats.WordCount,
+		stats.ReadingTime,
+		marshalledTableOfContents,
+		post.MembersOnly,
+		version,
 	)
 	if err != nil {
 		return err
 	}
 
+	// another save may have landed since the post was read
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+
+	if foundPost.Slug != post.Slug {
+		if err = recordPostSlug(ctx, tx, foundPost.Slug, postID, siteID); err != nil {
+			return err
+		}
+		if err = claimPostSlug(ctx, tx, post.Slug, siteID); err != nil {
+			return err
+		}
+	}
+
+	if err = setPostTaxonomy(ctx, tx, post, postID, siteID); err != nil {
+		return err
+	}
+
+	if err = insertPostRevision(ctx, tx, post, postID, userID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// recordPostSlug keeps a slug a post is moving away from, so links to it can
+// be redirected. A slug that used to belong to another post now points here.
+func recordPostSlug(ctx context.Context, tx *sql.Tx, slug, postID, siteID string) error {
+	stmt := `
+		INSERT INTO post_slug_history
+			(id, post_id, site_id, slug, created_at)
+		VALUES
+			($1, $2, $3, $4, $5)
+		ON CONFLICT (site_id, slug)
+		DO UPDATE SET post_id = EXCLUDED.post_id, created_at = EXCLUDED.created_at
+	`
+
+	uuid, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, stmt, uuid, postID, siteID, slug, time.Now())
+	return err
+}
+
+// claimPostSlug drops the history entry for a slug a post is taking, so the
+// live post is what readers get.
+func claimPostSlug(ctx context.Context, tx *sql.Tx, slug, siteID string) error {
+	stmt := `
+		DELETE FROM post_slug_history
+		WHERE site_id = $1 AND slug = $2
+	`
+
+	_, err := tx.ExecContext(ctx, stmt, siteID, slug)
+	return err
+}
+
+// GenerateUniquePostSlug derives a slug from a title and adds a numeric
+// suffix until it is used neither by a post of the site nor by its slug
+// history, and does not collide with a public route.
+func (s *Store) GenerateUniquePostSlug(title, siteID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	base := helpers.Slugify(title)
+	if base == "" {
+		base = "post"
+	}
+
+	// slugs only contain letters, digits and dashes, so the pattern needs no
+	// escaping. Trashed posts keep their slug in case they are restored.
+	query := `
+		SELECT slug FROM posts
+		WHERE site_id = $1 AND (slug = $2 OR slug LIKE $2 || '-%')
+		UNION
+		SELECT slug FROM post_slug_history
+		WHERE site_id = $1 AND (slug = $2 OR slug LIKE $2 || '-%')
+	`
+	rows, err := s.db.QueryContext(ctx, query, siteID, base)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	taken := map[string]bool{}
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return "", err
+		}
+		taken[slug] = true
+	}
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+
+	slug := base
+	for n := 2; taken[slug] || isReservedSlug(slug); n++ {
+		slug = fmt.Sprintf("%v-%d", base, n)
+	}
+
+	return slug, nil
+}
+
+// GetCurrentSitePostSlug looks up a slug in the history of a site and returns
+// the slug the published post carries now.
+func (s *Store) GetCurrentSitePostSlug(subdirectory, slug string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT p.slug
+		FROM post_slug_history h
+		INNER JOIN posts p
+		ON h.post_id = p.id
+		INNER JOIN sites s
+		ON h.site_id = s.id
+		WHERE s.subdirectory = $1 AND h.slug = $2
+			AND p.status = 'published' AND p.published_at <= $3
+			AND p.deleted_at IS NULL AND s.deleted_at IS NULL
+	`
+
+	var currentSlug string
+	err := s.db.QueryRowContext(ctx, query, subdirectory, slug, time.Now()).Scan(&currentSlug)
+	if err != nil {
+		return "", err
+	}
+
+	return currentSlug, nil
+}
+
+// DeletePost moves a post to the trash. It stays there, hidden from every
+// other query, until it is restored or purged.
 func (s *Store) DeletePost(postID, siteID, userID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	stmt := `
-		DELETE FROM posts
-		WHERE id = $1 AND site_id = $2 AND user_id = $3
+		UPDATE posts
+		SET deleted_at = $1
+		WHERE id = $2 AND site_id = $3 AND user_id = $4 AND deleted_at IS NULL
 	`
 
-	_, err := s.db.ExecContext(ctx, stmt, postID, siteID, userID)
+	result, err := s.db.ExecContext(ctx, stmt, time.Now(), postID, siteID, userID)
 	if err != nil {
 		return err
 	}
 
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
 	return nil
 }
+
+func (s *Store) GetTrashedPosts(
+	siteID, userID string,
+	page pagination.Params,
+) ([]models.Post, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// posts trashed along with their site come back with the site
+	query := `
+		SELECT p.id, p.title, p.small_description, p.image, p.slug, p.status, p.published_at,
+			p.created_at, p.deleted_at, p.user_id, p.site_id
+		FROM posts p
+		INNER JOIN sites s
+		ON p.site_id = s.id
+		WHERE p.site_id = $1 AND p.user_id = $2 AND p.deleted_at IS NOT NULL
+			AND s.deleted_at IS NULL
+	`
+	clause, args := page.Clause("p.created_at", "p.id", []any{siteID, userID})
+
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(
+			&post.ID,
+			&post.Title,
+			&post.SmallDescription,
+			&post.Image,
+			&post.Slug,
+			&post.Status,
+			&post.PublishedAt,
+			&post.CreatedAt,
+			&post.DeletedAt,
+			&post.UserID,
+			&post.SiteID,
+		)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+		posts = append(posts, post)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	posts, nextPage := pagination.Trim(posts, page, postCursor)
+	return posts, nextPage, nil
+}
+
+func (s *Store) RestorePost(postID, siteID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE posts p
+		SET deleted_at = NULL, updated_at = $1, version = p.version + 1
+		FROM sites s
+		WHERE p.site_id = s.id AND s.deleted_at IS NULL
+			AND p.id = $2 AND p.site_id = $3 AND p.user_id = $4 AND p.deleted_at IS NOT NULL
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt, time.Now(), postID, siteID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// IsPostSlugTaken reports whether another post of the site uses slug. Trashed
+// posts count, since they get their slug back when restored.
+func (s *Store) IsPostSlugTaken(slug, siteID, postID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var taken bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM posts
+			WHERE slug = $1 AND site_id = $2 AND id <> $3
+		)
+	`
+	err := s.db.QueryRowContext(ctx, query, slug, siteID, postID).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+
+	return taken, nil
+}
+
+// PurgeTrash permanently deletes posts that were trashed before the cutoff.
+func (s *Store) PurgeTrash(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stmt := `
+		DELETE FROM posts
+		WHERE deleted_at < $1
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (s *Store) UpdatePostStatus(
+	postID, siteID, userID, status string,
+	publishedAt *time.Time,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE posts
+		SET
+			status = $1,
+			published_at = $2,
+			updated_at = $3,
+			version = version + 1,
+			publish_attempts = 0,
+			publish_retry_at = NULL
+		WHERE id = $4 AND site_id = $5 AND user_id = $6 AND deleted_at IS NULL
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt,
+		status,
+		publishedAt,
+		time.Now(),
+		postID,
+		siteID,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// MaxPublishAttempts is how often the scheduler tries to publish a post before
+// giving up on it. Scheduling the post again starts over.
+const MaxPublishAttempts = 5
+
+// publishRetryDelay backs off exponentially from a minute, capped at an hour.
+func publishRetryDelay(attempts int) time.Duration {
+	return min(time.Minute<<min(attempts, 6), time.Hour)
+}
+
+// rows are claimed with SKIP LOCKED so several server instances can run the
+// scheduler at once without publishing a post twice
+func (s *Store) PublishDuePosts(now time.Time, limit int) ([]models.PublishEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, site_id, published_at, publish_attempts
+		FROM posts
+		WHERE status = 'scheduled' AND published_at <= $1 AND deleted_at IS NULL
+			AND publish_attempts < $3 AND (publish_retry_at IS NULL OR publish_retry_at <= $1)
+		ORDER BY published_at
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`
+	rows, err := tx.QueryContext(ctx, query, now, limit, MaxPublishAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []models.PublishEvent
+	var attempts []int
+	for rows.Next() {
+		var event models.PublishEvent
+		var attempt int
+		err := rows.Scan(&event.PostID, &event.SiteID, &event.ScheduledFor, &attempt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		events = append(events, event)
+		attempts = append(attempts, attempt+1)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stmt := `
+		INSERT INTO post_publish_events
+			(id, post_id, scheduled_for, outcome, error, created_at)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+	`
+	for i := range events {
+		event := &events[i]
+
+		// a savepoint per post keeps one bad row from rolling back the whole batch
+		if _, err = tx.ExecContext(ctx, "SAVEPOINT publish_post"); err != nil {
+			return nil, err
+		}
+
+		event.Outcome = models.PostStatusPublished
+		_, err = tx.ExecContext(ctx, `
+			UPDATE posts
+			SET status = 'published', updated_at = $1, version = version + 1
+			WHERE id = $2
+		`, now, event.PostID)
+		if err != nil {
+			event.Outcome = "failed"
+			event.Error = err.Error()
+			if _, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT publish_post"); err != nil {
+				return nil, err
+			}
+
+			// the post is left alone after MaxPublishAttempts, until it is scheduled again
+			if attempts[i] >= MaxPublishAttempts {
+				event.Outcome = "abandoned"
+			}
+			_, err = tx.ExecContext(ctx, `
+				UPDATE posts
+				SET publish_attempts = $1, publish_retry_at = $2
+				WHERE id = $3
+			`, attempts[i], now.Add(publishRetryDelay(attempts[i])), event.PostID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		eventID, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tx.ExecContext(ctx, stmt,
+			eventID,
+			event.PostID,
+			event.ScheduledFor,
+			event.Outcome,
+			sql.NullString{String: event.Error, Valid: event.Error != ""},
+			now,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// the post row is written first in the same transaction, so its row lock
+// serialises concurrent edits while the next revision number is picked
+func insertPostRevision(
+	ctx context.Context,
+	tx *sql.Tx,
+	post models.CreatePostPayload,
+	postID, userID string,
+) error {
+	stmt := `
+		INSERT INTO post_revisions
+			(id, post_id, revision_number, title, article_content, small_description, image, slug, user_id, created_at)
+		SELECT
+			$1, $2, COALESCE(MAX(revision_number), 0) + 1, $3, $4, $5, $6, $7, $8, $9
+		FROM post_revisions
+		WHERE post_id = $2
+	`
+
+	uuid, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, stmt,
+		uuid,
+		postID,
+		&post.Title,
+		&post.ArticleContent,
+		&post.SmallDescription,
+		&post.Image,
+		&post.Slug,
+		userID,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetPostRevisions lists the revisions of a post of the user, newest first.
+// It returns sql.ErrNoRows when the post is not theirs or does not exist.
+func (s *Store) GetPostRevisions(postID, siteID, userID string) ([]models.PostRevisionSummary, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var owned bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM posts
+			WHERE id = $1 AND site_id = $2 AND user_id = $3 AND deleted_at IS NULL
+		)
+	`
+	if err := s.db.QueryRowContext(ctx, query, postID, siteID, userID).Scan(&owned); err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, sql.ErrNoRows
+	}
+
+	query = `
+		SELECT r.id, r.revision_number, r.title, r.user_id, r.created_at
+		FROM post_revisions r
+		INNER JOIN posts p
+		ON r.post_id = p.id
+		WHERE r.post_id = $1 AND p.site_id = $2 AND p.user_id = $3 AND p.deleted_at IS NULL
+		ORDER BY r.revision_number DESC;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, postID, siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []models.PostRevisionSummary
+	for rows.Next() {
+		var revision models.PostRevisionSummary
+		err := rows.Scan(
+			&revision.ID,
+			&revision.RevisionNumber,
+			&revision.Title,
+			&revision.UserID,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (s *Store) GetPostRevision(
+	revisionID, postID, siteID, userID string,
+) (*models.PostRevision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			r.id, r.post_id, r.revision_number, r.title, r.article_content,
+			r.small_description, r.image, r.slug, r.user_id, r.created_at
+		FROM post_revisions r
+		INNER JOIN posts p
+		ON r.post_id = p.id
+		WHERE r.id = $1 AND r.post_id = $2 AND p.site_id = $3 AND p.user_id = $4
+			AND p.deleted_at IS NULL
+	`
+
+	revision := new(models.PostRevision)
+	var marshalledArticleContent []byte
+	err := s.db.QueryRowContext(ctx, query, revisionID, postID, siteID, userID).Scan(
+		&revision.ID,
+		&revision.PostID,
+		&revision.RevisionNumber,
+		&revision.Title,
+		&marshalledArticleContent,
+		&revision.SmallDescription,
+		&revision.Image,
+		&revision.Slug,
+		&revision.UserID,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err = json.Unmarshal(marshalledArticleContent, &revision.ArticleContent); err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+// RestorePostRevision makes a revision the current content of the post,
+// provided the post is still at version.
+func (s *Store) RestorePostRevision(revisionID, postID, siteID, userID string, version int) error {
+	revision, err := s.GetPostRevision(revisionID, postID, siteID, userID)
+	if err != nil {
+		return err
+	}
+	if revision == nil {
+		return sql.ErrNoRows
+	}
+
+	post, err := s.GetPostByID(postID, siteID, userID)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return sql.ErrNoRows
+	}
+
+	// restoring is recorded as a new revision rather than rewinding history
+	return s.EditPost(models.CreatePostPayload{
+		Title:            revision.Title,
+		ArticleContent:   revision.ArticleContent,
+		SmallDescription: revision.SmallDescription,
+		Image:            revision.Image,
+		Slug:             revision.Slug,
+		MembersOnly:      post.MembersOnly,
+	}, postID, userID, siteID, version)
+}
+
+func (s *Store) CreatePostPreview(
+	postID, siteID, userID string,
+	expiresAt time.Time,
+	maxViews int,
+) (*models.PostPreview, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// selecting from posts makes the insert a no-op for posts the user does not own
+	stmt := `
+		INSERT INTO post_previews
+			(id, post_id, user_id, max_views, view_count, expires_at, created_at)
+		SELECT $1, id, $2, $3, 0, $4, $5
+		FROM posts
+		WHERE id = $6 AND site_id = $7 AND user_id = $2 AND deleted_at IS NULL
+		RETURNING id, post_id, max_views, view_count, expires_at, revoked_at, created_at
+	`
+
+	uuid, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	preview := new(models.PostPreview)
+	err = s.db.QueryRowContext(ctx, stmt,
+		uuid,
+		userID,
+		maxViews,
+		expiresAt,
+		time.Now(),
+		postID,
+		siteID,
+	).Scan(
+		&preview.ID,
+		&preview.PostID,
+		&preview.MaxViews,
+		&preview.ViewCount,
+		&preview.ExpiresAt,
+		&preview.RevokedAt,
+		&preview.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
+
+func (s *Store) GetPostPreviews(postID, siteID, userID string) ([]models.PostPreview, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT pp.id, pp.post_id, pp.max_views, pp.view_count, pp.expires_at, pp.revoked_at, pp.created_at
+		FROM post_previews pp
+		INNER JOIN posts p
+		ON pp.post_id = p.id
+		WHERE pp.post_id = $1 AND p.site_id = $2 AND p.user_id = $3 AND p.deleted_at IS NULL
+		ORDER BY pp.created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, postID, siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var previews []models.PostPreview
+	for rows.Next() {
+		var preview models.PostPreview
+		err := rows.Scan(
+			&preview.ID,
+			&preview.PostID,
+			&preview.MaxViews,
+			&preview.ViewCount,
+			&preview.ExpiresAt,
+			&preview.RevokedAt,
+			&preview.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		previews = append(previews, preview)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return previews, nil
+}
+
+func (s *Store) RevokePostPreview(previewID, postID, siteID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE post_previews pp
+		SET revoked_at = $1
+		FROM posts p
+		WHERE pp.post_id = p.id AND pp.revoked_at IS NULL
+			AND pp.id = $2 AND pp.post_id = $3 AND p.site_id = $4 AND p.user_id = $5
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt, time.Now(), previewID, postID, siteID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// UsePostPreview counts a view of a preview and returns its post. The count
+// only goes up while the preview is live and under its limit, so concurrent
+// readers cannot get past max_views.
+func (s *Store) UsePostPreview(previewID string) (*models.Post, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var postID string
+	stmt := `
+		UPDATE post_previews
+		SET view_count = view_count + 1
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > $2 AND view_count < max_views
+		RETURNING post_id
+	`
+	if err = tx.QueryRowContext(ctx, stmt, previewID, time.Now()).Scan(&postID); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + postColumns + `
+		FROM posts
+		WHERE id = $1 AND deleted_at IS NULL
+			AND site_id IN (SELECT id FROM sites WHERE deleted_at IS NULL)
+	`
+	post, err := scanPost(tx.QueryRowContext(ctx, query, postID))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// matches are highlighted with <mark>; the source text is HTML-escaped first
+// so the snippets are safe to render as-is
+// searchResultColumns lists what scanSearchResults reads, ranked by
+// searchVector.
+func searchResultColumns(searchVector string) string {
+	return `
+	p.id, p.title, p.small_description, p.image, p.slug, p.status, p.created_at, p.site_id,
+	ts_headline(
+		'english',
+		replace(replace(replace(p.title, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+		q.query,
+		'StartSel=<mark>, StopSel=</mark>, HighlightAll=true'
+	),
+	ts_headline(
+		'english',
+		replace(replace(replace(post_article_text(p.article_content), '&', '&amp;'), '<', '&lt;'), '>', '&gt;'),
+		q.query,
+		'StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10'
+	),
+	ts_rank(` + searchVector + `, q.query) AS rank,
+	p.members_only
+`
+}
+
+func (s *Store) SearchPostsByUserID(
+	userID, query string,
+	limit int,
+) ([]models.PostSearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		SELECT ` + searchResultColumns("p.search_vector") + `
+		FROM posts p, websearch_to_tsquery('english', $1) AS q(query)
+		WHERE p.user_id = $2 AND p.deleted_at IS NULL AND p.search_vector @@ q.query
+		ORDER BY rank DESC, p.created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, stmt, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSearchResults(rows)
+}
+
+// SearchSitePosts searches the published posts of a site. Members-only posts
+// are matched on their whole text only for readerID's own posts or when the
+// reader is subscribed, for everyone else on their title and description,
+// what the paywall lets anyone see.
+func (s *Store) SearchSitePosts(
+	subdirectory, query string,
+	limit int,
+	readerID string,
+	subscribed bool,
+) ([]models.PostSearchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var siteID string
+	stmt := `
+		SELECT id FROM sites
+		WHERE subdirectory = $1 AND deleted_at IS NULL
+	`
+	err := s.db.QueryRowContext(ctx, stmt, subdirectory).Scan(&siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `
+		SELECT ` + searchResultColumns("v.search_vector") + `
+		FROM posts p
+		CROSS JOIN websearch_to_tsquery('english', $1) AS q(query)
+		CROSS JOIN LATERAL (
+			SELECT CASE
+				WHEN p.members_only AND NOT $5 AND p.user_id <> $6 THEN
+					setweight(to_tsvector('english', COALESCE(p.title, '')), 'A') ||
+					setweight(to_tsvector('english', COALESCE(p.small_description, '')), 'B')
+				ELSE p.search_vector
+			END
+		) AS v(search_vector)
+		WHERE
+			p.site_id = $2 AND p.status = 'published' AND p.published_at <= $3
+			AND p.deleted_at IS NULL AND p.search_vector @@ q.query
+			AND v.search_vector @@ q.query
+		ORDER BY rank DESC, p.created_at DESC
+		LIMIT $4
+	`
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		stmt,
+		query,
+		siteID,
+		time.Now(),
+		limit,
+		subscribed,
+		readerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSearchResults(rows)
+}
+
+func scanSearchResults(rows *sql.Rows) ([]models.PostSearchResult, error) {
+	var results []models.PostSearchResult
+	for rows.Next() {
+		var result models.PostSearchResult
+		err := rows.Scan(
+			&result.ID,
+			&result.Title,
+			&result.SmallDescription,
+			&result.Image,
+			&result.Slug,
+			&result.Status,
+			&result.CreatedAt,
+			&result.SiteID,
+			&result.Headline,
+			&result.Snippet,
+			&result.Rank,
+			&result.MembersOnly,
+		)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func unmarshalPostTaxonomy(post *models.Post, marshalledTags, marshalledCategory []byte) error {
+	if err := json.Unmarshal(marshalledTags, &post.Tags); err != nil {
+		return err
+	}
+
+	if marshalledCategory != nil {
+		post.Category = new(models.Topic)
+		if err := json.Unmarshal(marshalledCategory, post.Category); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// a nil category or tag list in the payload leaves the current value untouched
+func setPostTaxonomy(
+	ctx context.Context,
+	tx *sql.Tx,
+	post models.CreatePostPayload,
+	postID, siteID string,
+) error {
+	if post.CategoryID != nil {
+		var categoryID sql.NullString
+		if *post.CategoryID != "" {
+			query := `
+				SELECT id FROM categories
+				WHERE id = $1 AND site_id = $2
+			`
+			err := tx.QueryRowContext(ctx, query, *post.CategoryID, siteID).Scan(&categoryID)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return ErrCategoryNotFound
+				}
+				return err
+			}
+		}
+
+		stmt := `
+			UPDATE posts
+			SET category_id = $1
+			WHERE id = $2
+		`
+		if _, err := tx.ExecContext(ctx, stmt, categoryID, postID); err != nil {
+			return err
+		}
+	}
+
+	if post.Tags == nil {
+		return nil
+	}
+
+	stmt := `
+		DELETE FROM post_tags
+		WHERE post_id = $1
+	`
+	if _, err := tx.ExecContext(ctx, stmt, postID); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range post.Tags {
+		name = strings.TrimSpace(name)
+		slug := helpers.TopicSlug(name)
+		if slug == "" || seen[slug] {
+			continue
+		}
+		seen[slug] = true
+
+		uuid, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+
+		var tagID string
+		stmt = `
+			INSERT INTO tags
+				(id, name, slug, site_id, created_at, updated_at)
+			VALUES
+				($1, $2, $3, $4, $5, $5)
+			ON CONFLICT (site_id, slug) DO UPDATE
+			SET slug = EXCLUDED.slug
+			RETURNING id
+		`
+		err = tx.QueryRowContext(ctx, stmt, uuid, name, slug, siteID, time.Now()).Scan(&tagID)
+		if err != nil {
+			return err
+		}
+
+		stmt = `
+			INSERT INTO post_tags
+				(post_id, tag_id)
+			VALUES
+				($1, $2)
+		`
+		if _, err = tx.ExecContext(ctx, stmt, postID, tagID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) getSiteName(ctx context.Context, subdirectory string) (*models.SiteName, error) {
+	site := new(models.SiteName)
+	query := `
+		SELECT id, name FROM sites
+		WHERE subdirectory = $1 AND deleted_at IS NULL
+	`
+	err := s.db.QueryRowContext(ctx, query, subdirectory).Scan(&site.ID, &site.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return site, nil
+}
+
+func (s *Store) GetSiteTags(subdirectory string) ([]models.Topic, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	site, err := s.getSiteName(ctx, subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT t.name, t.slug, COUNT(p.id)
+		FROM tags t
+		INNER JOIN post_tags pt
+		ON pt.tag_id = t.id
+		INNER JOIN posts p
+		ON pt.post_id = p.id
+		WHERE t.site_id = $1 AND p.status = 'published' AND p.published_at <= $2
+			AND p.deleted_at IS NULL
+		GROUP BY t.id, t.name, t.slug
+		ORDER BY t.name;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, site.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTopics(rows)
+}
+
+func (s *Store) GetSiteCategories(subdirectory string) ([]models.Topic, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	site, err := s.getSiteName(ctx, subdirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT c.name, c.slug, COUNT(p.id)
+		FROM categories c
+		LEFT JOIN posts p
+		ON p.category_id = c.id AND p.status = 'published' AND p.published_at <= $2
+			AND p.deleted_at IS NULL
+		WHERE c.site_id = $1
+		GROUP BY c.id, c.name, c.slug
+		ORDER BY c.name;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, site.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTopics(rows)
+}
+
+func scanTopics(rows *sql.Rows) ([]models.Topic, error) {
+	var topics []models.Topic
+	for rows.Next() {
+		var topic models.Topic
+		if err := rows.Scan(&topic.Name, &topic.Slug, &topic.PostCount); err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return topics, nil
+}
+
+func (s *Store) GetSitePostsByTag(
+	subdirectory, tag string,
+	page pagination.Params,
+) (*models.TopicPosts, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	site, err := s.getSiteName(ctx, subdirectory)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	var tagID string
+	topic := models.Topic{}
+	query := `
+		SELECT id, name, slug FROM tags
+		WHERE site_id = $1 AND slug = $2
+	`
+	err = s.db.QueryRowContext(ctx, query, site.ID, tag).Scan(&tagID, &topic.Name, &topic.Slug)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	query = `
+		SELECT p.id, p.title, p.small_description, p.image, p.slug, p.published_at, p.created_at, p.updated_at,
+			p.word_count, p.reading_time, p.members_only, media_image_set(p.image)
+		FROM posts p
+		INNER JOIN post_tags pt
+		ON pt.post_id = p.id
+		WHERE pt.tag_id = $1 AND p.status = 'published' AND p.published_at <= $2
+			AND p.deleted_at IS NULL
+	`
+	clause, args := page.Clause("p.created_at", "p.id", []any{tagID, time.Now()})
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPublicPostSummaries(rows)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	posts, nextPage := pagination.Trim(posts, page, postCursor)
+	return &models.TopicPosts{
+		Site:  *site,
+		Topic: topic,
+		Posts: posts,
+	}, nextPage, nil
+}
+
+func (s *Store) GetSitePostsByCategory(
+	subdirectory, category string,
+	page pagination.Params,
+) (*models.TopicPosts, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	site, err := s.getSiteName(ctx, subdirectory)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	var categoryID string
+	topic := models.Topic{}
+	query := `
+		SELECT id, name, slug FROM categories
+		WHERE site_id = $1 AND slug = $2
+	`
+	err = s.db.QueryRowContext(ctx, query, site.ID, category).
+		Scan(&categoryID, &topic.Name, &topic.Slug)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	query = `
+		SELECT id, title, small_description, image, slug, published_at, created_at, updated_at,
+      word_count, reading_time, members_only, media_image_set(image)
+		FROM posts
+		WHERE category_id = $1 AND status = 'published' AND published_at <= $2
+			AND deleted_at IS NULL
+	`
+	clause, args := page.Clause("created_at", "id", []any{categoryID, time.Now()})
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPublicPostSummaries(rows)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	posts, nextPage := pagination.Trim(posts, page, postCursor)
+	return &models.TopicPosts{
+		Site:  *site,
+		Topic: topic,
+		Posts: posts,
+	}, nextPage, nil
+}
+
+func scanPublicPostSummaries(rows *sql.Rows) ([]models.Post, error) {
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		var imageSet []byte
+		err := rows.Scan(
+			&post.ID,
+			&post.Title,
+			&post.SmallDescription,
+			&post.Image,
+			&post.Slug,
+			&post.PublishedAt,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.WordCount,
+			&post.ReadingTime,
+			&post.MembersOnly,
+			&imageSet,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if post.ImageSet, err = imaging.NewImageSet(post.Image, imageSet); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
@@ -1,34 +1,82 @@
 package sites
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 
 	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/mergepatch"
 	"github.com/mznrasil/my-blogs-be/internal/middleware"
 	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+	"github.com/mznrasil/my-blogs-be/internal/sitemap"
 )
 
 type Handler struct {
 	store models.SiteStore
+	cache models.SiteCache
 }
 
-func NewHandler(store models.SiteStore) *Handler {
+func NewHandler(store models.SiteStore, cache models.SiteCache) *Handler {
 	return &Handler{
 		store: store,
+		cache: cache,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.Use(middleware.WithAuth)
-	router.HandleFunc("/sites", h.CreateSite).Methods(http.MethodPost)
-	router.HandleFunc("/sites", h.GetAllSites).Methods(http.MethodGet)
-	router.HandleFunc("/sites/{siteID}", h.UpdateSiteImage).Methods(http.MethodPatch)
-	router.HandleFunc("/sites/{siteID}", h.DeleteSite).Methods(http.MethodDelete)
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/sites", h.CreateSite).Methods(http.MethodPost)
+	authRouter.HandleFunc("/sites", h.GetAllSites).Methods(http.MethodGet)
+	authRouter.HandleFunc("/sites/trash", h.GetTrashedSites).Methods(http.MethodGet)
+	authRouter.HandleFunc("/sites/{siteID}", h.UpdateSite).Methods(http.MethodPatch)
+	authRouter.HandleFunc("/sites/{siteID}", h.DeleteSite).Methods(http.MethodDelete)
+	authRouter.HandleFunc("/sites/{siteID}/restore", h.RestoreSite).Methods(http.MethodPost)
+
+	publicRouter := router.NewRoute().Subrouter()
+	publicRouter.HandleFunc("/sites/{subdirectory}/sitemap.xml", h.GetSitemap).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/sites/{subdirectory}/sitemap-{page:[0-9]+}.xml", h.GetSitemapPage).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/sites/{subdirectory}/robots.txt", h.GetRobots).
+		Methods(http.MethodGet)
+}
+
+// reservedSubdirectories are the words fixed routes use where others take a
+// subdirectory, such as /posts/search next to /posts/{subdirectory}. A site
+// named after one would be shadowed by it.
+var reservedSubdirectories = map[string]bool{
+	"search":  true,
+	"preview": true,
+	"cache":   true,
+	"trash":   true,
+	"media":   true,
+	"admin":   true,
+	"api":     true,
+}
+
+// subdirectoryPattern matches the lowercase, hyphenated names that are safe
+// in a URL path and a hostname label alike.
+var subdirectoryPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// checkSubdirectory returns why subdirectory cannot be used, or "" when it
+// can.
+func checkSubdirectory(subdirectory string) string {
+	if !subdirectoryPattern.MatchString(subdirectory) {
+		return "Subdirectory may only contain lowercase letters, digits and single hyphens"
+	}
+	if reservedSubdirectories[subdirectory] {
+		return "This subdirectory is reserved"
+	}
+
+	return ""
 }
 
 func (h *Handler) CreateSite(w http.ResponseWriter, r *http.Request) {
@@ -46,7 +94,12 @@ func (h *Handler) CreateSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	site, err := h.store.GetSiteBySubdirectory(newSite.Subdirectory)
+	if message := checkSubdirectory(newSite.Subdirectory); message != "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, message)
+		return
+	}
+
+	taken, err := h.store.IsSubdirectoryTaken(newSite.Subdirectory, "")
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
@@ -56,7 +109,7 @@ func (h *Handler) CreateSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if site != nil {
+	if taken {
 		helpers.WriteJSONError(
 			w,
 			http.StatusBadRequest,
@@ -66,6 +119,10 @@ func (h *Handler) CreateSite(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err = h.store.CreateSite(*newSite, userID); err != nil {
+		if err == ErrSubdirectoryTaken {
+			helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		helpers.WriteJSONError(
 			w,
 			http.StatusInternalServerError,
@@ -84,65 +141,200 @@ func (h *Handler) GetAllSites(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	takeParam := r.URL.Query().Get("take")
-	var take int
-	if takeParam != "" {
-		takeInt, err := strconv.Atoi(takeParam)
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sites, nextPage, err := h.store.GetAllSitesByUserId(userID, page)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONPage(w, http.StatusOK, "Sites fetched successfully", sites, nextPage)
+}
+
+func (h *Handler) UpdateSite(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(string)
+	siteID := mux.Vars(r)["siteID"]
+	if siteID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Site Id not provided")
+		return
+	}
+
+	patch, err := mergepatch.Read(w, r)
+	if err == nil {
+		err = mergepatch.RequireFields(patch, "name", "subdirectory")
+	}
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid patch: %v", err.Error()),
+		)
+		return
+	}
+
+	site, err := h.store.GetSiteByID(siteID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server Error: %v", err.Error()),
+		)
+		return
+	}
+	if site == nil || site.UserID != userID {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+		return
+	}
+
+	current := models.UpdateSitePayload{
+		Name:         site.Name,
+		Description:  site.Description,
+		Subdirectory: site.Subdirectory,
+		ImageUrl:     site.ImageUrl,
+	}
+	sitePayload := new(models.UpdateSitePayload)
+	if err = mergepatch.Apply(current, patch, sitePayload); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid patch: %v", err.Error()),
+		)
+		return
+	}
+
+	if err := helpers.Validate.Struct(sitePayload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid Payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	if sitePayload.Subdirectory != site.Subdirectory {
+		if message := checkSubdirectory(sitePayload.Subdirectory); message != "" {
+			helpers.WriteJSONError(w, http.StatusBadRequest, message)
+			return
+		}
+
+		taken, err := h.store.IsSubdirectoryTaken(sitePayload.Subdirectory, siteID)
 		if err != nil {
 			helpers.WriteJSONError(
 				w,
 				http.StatusInternalServerError,
-				fmt.Sprintf("Failed to convert take parameter to integer: %v", err.Error()),
+				fmt.Sprintf("Server Error: %v", err.Error()),
+			)
+			return
+		}
+		if taken {
+			helpers.WriteJSONError(
+				w,
+				http.StatusConflict,
+				"Site with this subdirectory already exists",
 			)
 			return
 		}
-		take = takeInt
 	}
 
-	sites, err := h.store.GetAllSitesByUserId(userID, take)
+	if err = h.store.UpdateSite(siteID, userID, *sitePayload); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		// another site may have taken it since the check above
+		if err == ErrSubdirectoryTaken {
+			helpers.WriteJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server Error: %v", err.Error()),
+		)
+		return
+	}
+	h.cache.InvalidateSite(siteID)
+
+	site, err = h.store.GetSiteByID(siteID)
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
 			http.StatusInternalServerError,
-			fmt.Sprintf("Error: %v", err.Error()),
+			fmt.Sprintf("Server Error: %v", err.Error()),
 		)
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Sites fetched successfully", sites)
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Site updated successfully", site)
 }
 
-func (h *Handler) UpdateSiteImage(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteSite(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(string)
 	siteID := mux.Vars(r)["siteID"]
+	if userID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "User ID not found")
+		return
+	}
 	if siteID == "" {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Site Id not provided")
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Site ID not found")
 		return
 	}
 
-	var data struct {
-		ImageUrl string `json:"image_url"`
+	err := h.store.DeleteSite(siteID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
 	}
-	helpers.DecodeJSONBody(w, r, &data)
-	if data.ImageUrl == "" {
-		helpers.WriteJSONError(w, http.StatusBadRequest, "Image url not provided")
+	h.cache.InvalidateSite(siteID)
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Site moved to trash", nil)
+}
+
+func (h *Handler) GetTrashedSites(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(string)
+	if userID == "" {
+		helpers.WriteJSONError(w, http.StatusNotFound, "User not found")
 		return
 	}
 
-	err := h.store.UpdateSiteImage(siteID, userID, data.ImageUrl)
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sites, nextPage, err := h.store.GetTrashedSites(userID, page)
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
 			http.StatusInternalServerError,
-			fmt.Sprintf("Server Error: %v", err.Error()),
+			fmt.Sprintf("Error: %v", err.Error()),
 		)
 		return
 	}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Updated site image", nil)
+	helpers.WriteJSONPage(w, http.StatusOK, "Trashed sites fetched successfully", sites, nextPage)
 }
 
-func (h *Handler) DeleteSite(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RestoreSite(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value("userID").(string)
 	siteID := mux.Vars(r)["siteID"]
 	if userID == "" {
@@ -154,7 +346,93 @@ func (h *Handler) DeleteSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.store.DeleteSite(siteID, userID)
+	err := h.store.RestoreSite(siteID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found in trash")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	h.cache.InvalidateSite(siteID)
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Site restored successfully", nil)
+}
+
+func (h *Handler) GetSitemap(w http.ResponseWriter, r *http.Request) {
+	site := h.getPublicSite(w, r)
+	if site == nil {
+		return
+	}
+
+	chunks, err := h.store.GetSitemapChunks(site.ID, sitemap.MaxURLs)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if len(chunks) <= 1 {
+		h.writeSitemapURLs(w, r, site, 0)
+		return
+	}
+
+	sitemaps := make([]sitemap.URL, 0, len(chunks))
+	for i, lastMod := range chunks {
+		sitemaps = append(sitemaps, sitemap.URL{
+			Loc: fmt.Sprintf(
+				"%v/sites/%v/sitemap-%d.xml",
+				helpers.APIRootURL(r, "/sites/"+site.Subdirectory+"/sitemap.xml"),
+				site.Subdirectory,
+				i+1,
+			),
+			LastMod: lastMod,
+		})
+	}
+
+	body, err := sitemap.Index(sitemaps)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	writeXML(w, body)
+}
+
+func (h *Handler) GetSitemapPage(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(mux.Vars(r)["page"])
+	if err != nil || page < 1 {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Sitemap not found")
+		return
+	}
+
+	site := h.getPublicSite(w, r)
+	if site == nil {
+		return
+	}
+
+	h.writeSitemapURLs(w, r, site, page-1)
+}
+
+func (h *Handler) writeSitemapURLs(
+	w http.ResponseWriter,
+	r *http.Request,
+	site *models.Site,
+	chunk int,
+) {
+	entries, err := h.store.GetSitemapEntries(site.ID, chunk*sitemap.MaxURLs, sitemap.MaxURLs)
 	if err != nil {
 		helpers.WriteJSONError(
 			w,
@@ -163,6 +441,86 @@ func (h *Handler) DeleteSite(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	if len(entries) == 0 && chunk > 0 {
+		helpers.WriteJSONError(w, http.StatusNotFound, "Sitemap not found")
+		return
+	}
+
+	urls := make([]sitemap.URL, 0, len(entries))
+	for _, entry := range entries {
+		urls = append(urls, sitemap.URL{
+			Loc:     helpers.PostURL(site.Subdirectory, entry.Slug),
+			LastMod: entry.UpdatedAt,
+		})
+	}
+
+	body, err := sitemap.URLSet(urls)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	writeXML(w, body)
+}
+
+func (h *Handler) GetRobots(w http.ResponseWriter, r *http.Request) {
+	site := h.getPublicSite(w, r)
+	if site == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(
+		w,
+		"User-agent: *\nAllow: /\n\nSitemap: %v/sites/%v/sitemap.xml\n",
+		helpers.APIRootURL(r, "/sites/"+site.Subdirectory+"/robots.txt"),
+		site.Subdirectory,
+	)
+}
+
+func (h *Handler) getPublicSite(w http.ResponseWriter, r *http.Request) *models.Site {
+	subdirectory := mux.Vars(r)["subdirectory"]
+	if subdirectory == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Subdirectory not provided")
+		return nil
+	}
+
+	site, err := h.store.GetSiteBySubdirectory(subdirectory)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return nil
+	}
+	if site == nil {
+		currentSubdirectory, err := h.store.GetCurrentSubdirectory(subdirectory)
+		switch {
+		case err == sql.ErrNoRows:
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+		case err != nil:
+			helpers.WriteJSONError(
+				w,
+				http.StatusInternalServerError,
+				fmt.Sprintf("Server error: %v", err.Error()),
+			)
+		default:
+			helpers.WriteSiteMoved(w, r, currentSubdirectory)
+		}
+		return nil
+	}
+
+	return site
+}
 
-	helpers.WriteJSONSuccess(w, http.StatusOK, "Deleted site successfully", nil)
+func writeXML(w http.ResponseWriter, body []byte) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
 }
@@ -7,10 +7,15 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 
+	"github.com/mznrasil/my-blogs-be/internal/imaging"
 	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
 )
 
+var ErrSubdirectoryTaken = errors.New("Site with this subdirectory already exists")
+
 type Store struct {
 	db *sql.DB
 }
@@ -25,6 +30,12 @@ func (s *Store) CreateSite(newSite models.CreateSitePayload, userID string) erro
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	stmt := `
     INSERT INTO sites
       (id, name, description, subdirectory, image_url, created_at, updated_at, user_id)
@@ -37,7 +48,7 @@ func (s *Store) CreateSite(newSite models.CreateSitePayload, userID string) erro
 		return err
 	}
 
-	_, err = s.db.ExecContext(
+	_, err = tx.ExecContext(
 		ctx,
 		stmt,
 		uuid,
@@ -50,24 +61,49 @@ func (s *Store) CreateSite(newSite models.CreateSitePayload, userID string) erro
 		userID,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrSubdirectoryTaken
+		}
+		return err
+	}
+
+	if err = claimSubdirectory(ctx, tx, newSite.Subdirectory); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// claimSubdirectory drops the history entry for a subdirectory a site is
+// taking, so the live site is what readers get.
+func claimSubdirectory(ctx context.Context, tx *sql.Tx, subdirectory string) error {
+	stmt := `
+		DELETE FROM site_subdirectory_history
+		WHERE subdirectory = $1
+	`
+
+	_, err := tx.ExecContext(ctx, stmt, subdirectory)
+	return err
+}
+
 func (s *Store) GetSiteByID(siteID string) (*models.Site, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	query := `
     SELECT
-      id, name, description, subdirectory, image_url, created_at, updated_at, user_id
+      id, name, description, subdirectory, image_url, created_at, updated_at, user_id,
+      media_image_set(image_url)
     FROM sites
-    WHERE id = $1
+    WHERE id = $1 AND deleted_at IS NULL
   `
 
 	site := new(models.Site)
+	var imageSet []byte
 	err := s.db.QueryRowContext(ctx, query, siteID).Scan(
 		&site.ID,
 		&site.Name,
@@ -77,6 +113,7 @@ func (s *Store) GetSiteByID(siteID string) (*models.Site, error) {
 		&site.CreatedAt,
 		&site.UpdatedAt,
 		&site.UserID,
+		&imageSet,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -85,6 +122,10 @@ func (s *Store) GetSiteByID(siteID string) (*models.Site, error) {
 		return nil, err
 	}
 
+	if site.ImageSet, err = imaging.NewImageSet(site.ImageUrl, imageSet); err != nil {
+		return nil, err
+	}
+
 	return site, nil
 }
 
@@ -94,12 +135,14 @@ func (s *Store) GetSiteBySubdirectory(subdirectory string) (*models.Site, error)
 
 	query := `
     SELECT
-      id, name, description, subdirectory, image_url, created_at, updated_at, user_id
+      id, name, description, subdirectory, image_url, created_at, updated_at, user_id,
+      media_image_set(image_url)
     FROM sites
-    WHERE subdirectory = $1
+    WHERE subdirectory = $1 AND deleted_at IS NULL
   `
 
 	site := new(models.Site)
+	var imageSet []byte
 	err := s.db.QueryRowContext(ctx, query, subdirectory).Scan(
 		&site.ID,
 		&site.Name,
@@ -109,6 +152,7 @@ func (s *Store) GetSiteBySubdirectory(subdirectory string) (*models.Site, error)
 		&site.CreatedAt,
 		&site.UpdatedAt,
 		&site.UserID,
+		&imageSet,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -117,31 +161,31 @@ func (s *Store) GetSiteBySubdirectory(subdirectory string) (*models.Site, error)
 		return nil, err
 	}
 
+	if site.ImageSet, err = imaging.NewImageSet(site.ImageUrl, imageSet); err != nil {
+		return nil, err
+	}
+
 	return site, nil
 }
 
-func (s *Store) GetAllSitesByUserId(userID string, take int) ([]models.Site, error) {
+func (s *Store) GetAllSitesByUserId(
+	userID string,
+	page pagination.Params,
+) ([]models.Site, pagination.Page, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var args []interface{}
-
 	query := `
-	    SELECT id, name, description, subdirectory, image_url, created_at, updated_at, user_id
+	    SELECT id, name, description, subdirectory, image_url, created_at, updated_at, user_id,
+	      media_image_set(image_url)
 	    FROM sites
-	    WHERE user_id = $1
-	    ORDER BY created_at DESC
+	    WHERE user_id = $1 AND deleted_at IS NULL
 	`
-	args = append(args, userID)
-
-	if take != 0 {
-		query += `LIMIT $2`
-		args = append(args, take)
-	}
+	clause, args := page.Clause("created_at", "id", []any{userID})
 
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
 	if err != nil {
-		return nil, err
+		return nil, pagination.Page{}, err
 	}
 	defer rows.Close()
 
@@ -149,6 +193,7 @@ func (s *Store) GetAllSitesByUserId(userID string, take int) ([]models.Site, err
 
 	for rows.Next() {
 		var site models.Site
+		var imageSet []byte
 		err := rows.Scan(
 			&site.ID,
 			&site.Name,
@@ -158,75 +203,383 @@ func (s *Store) GetAllSitesByUserId(userID string, take int) ([]models.Site, err
 			&site.CreatedAt,
 			&site.UpdatedAt,
 			&site.UserID,
+			&imageSet,
 		)
 		if err != nil {
-			return nil, err
+			return nil, pagination.Page{}, err
+		}
+		if site.ImageSet, err = imaging.NewImageSet(site.ImageUrl, imageSet); err != nil {
+			return nil, pagination.Page{}, err
 		}
 		sites = append(sites, site)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, pagination.Page{}, err
 	}
 
-	return sites, nil
+	sites, nextPage := pagination.Trim(sites, page, func(site models.Site) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: site.CreatedAt, ID: site.ID}
+	})
+	return sites, nextPage, nil
 }
 
-func (s *Store) UpdateSiteImage(siteID, userID, imageUrl string) error {
+// UpdateSite saves a site's settings. A subdirectory it gives up is kept in
+// the history, so its old links can be redirected.
+func (s *Store) UpdateSite(siteID, userID string, site models.UpdateSitePayload) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	site, err := s.GetSiteByID(siteID)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if site == nil {
-		return errors.New("Site not found")
+	defer tx.Rollback()
+
+	var previousSubdirectory string
+	query := `
+		SELECT subdirectory FROM sites
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	err = tx.QueryRowContext(ctx, query, siteID, userID).Scan(&previousSubdirectory)
+	if err != nil {
+		return err
 	}
 
+	now := time.Now()
 	stmt := `
 		UPDATE sites
 		SET
-			id = $1,
-			name = $2,
-			description = $3,
-			subdirectory = $4,
-			image_url = $5,
-			created_at = $6,
-			updated_at = $7,
-			user_id = $8
-		WHERE id = $1 AND user_id = $8
+			name = $1,
+			description = $2,
+			subdirectory = $3,
+			image_url = $4,
+			updated_at = $5
+		WHERE id = $6
 	`
-	_, err = s.db.ExecContext(ctx, stmt,
-		siteID,
+	_, err = tx.ExecContext(ctx, stmt,
 		site.Name,
 		site.Description,
 		site.Subdirectory,
-		imageUrl,
-		site.CreatedAt,
-		time.Now(),
-		userID,
+		site.ImageUrl,
+		now,
+		siteID,
 	)
 	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrSubdirectoryTaken
+		}
+		return err
+	}
+
+	if previousSubdirectory != site.Subdirectory {
+		stmt = `
+			INSERT INTO site_subdirectory_history (subdirectory, site_id, created_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (subdirectory) DO UPDATE
+			SET site_id = EXCLUDED.site_id, created_at = EXCLUDED.created_at
+		`
+		if _, err = tx.ExecContext(ctx, stmt, previousSubdirectory, siteID, now); err != nil {
+			return err
+		}
+
+		if err = claimSubdirectory(ctx, tx, site.Subdirectory); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// GetCurrentSubdirectory returns the subdirectory of the site that last gave
+// up subdirectory. It returns sql.ErrNoRows when no site gave it up, when
+// that site has been trashed and when another site has taken it since.
+func (s *Store) GetCurrentSubdirectory(subdirectory string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT s.subdirectory
+		FROM site_subdirectory_history h
+		INNER JOIN sites s
+		ON h.site_id = s.id
+		WHERE h.subdirectory = $1 AND s.deleted_at IS NULL
+	`
+
+	var currentSubdirectory string
+	err := s.db.QueryRowContext(ctx, query, subdirectory).Scan(&currentSubdirectory)
+	if err != nil {
+		return "", err
+	}
+
+	return currentSubdirectory, nil
+}
+
 func (s *Store) DeleteSite(siteID, userID string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
 	stmt := `
-		DELETE FROM sites
-		WHERE id = $1 AND user_id = $2
+		UPDATE sites
+		SET deleted_at = $1
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, stmt, now, siteID, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	stmt = `
+		UPDATE posts
+		SET deleted_at = $1
+		WHERE site_id = $2 AND deleted_at IS NULL
 	`
+	if _, err = tx.ExecContext(ctx, stmt, now, siteID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) GetTrashedSites(
+	userID string,
+	page pagination.Params,
+) ([]models.Site, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+	    SELECT
+	      id, name, description, subdirectory, image_url, created_at, updated_at, deleted_at, user_id
+	    FROM sites
+	    WHERE user_id = $1 AND deleted_at IS NOT NULL
+	`
+	clause, args := page.Clause("created_at", "id", []any{userID})
+
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	defer rows.Close()
+
+	var sites []models.Site
+	for rows.Next() {
+		var site models.Site
+		err := rows.Scan(
+			&site.ID,
+			&site.Name,
+			&site.Description,
+			&site.Subdirectory,
+			&site.ImageUrl,
+			&site.CreatedAt,
+			&site.UpdatedAt,
+			&site.DeletedAt,
+			&site.UserID,
+		)
+		if err != nil {
+			return nil, pagination.Page{}, err
+		}
+		sites = append(sites, site)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	sites, nextPage := pagination.Trim(sites, page, func(site models.Site) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: site.CreatedAt, ID: site.ID}
+	})
+	return sites, nextPage, nil
+}
+
+// RestoreSite takes a site out of the trash together with the posts that
+// were trashed with it.
+func (s *Store) RestoreSite(siteID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, stmt, siteID, userID)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	var deletedAt time.Time
+	query := `
+		SELECT deleted_at FROM sites
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL
+		FOR UPDATE
+	`
+	if err = tx.QueryRowContext(ctx, query, siteID, userID).Scan(&deletedAt); err != nil {
+		return err
+	}
+
+	stmt := `
+		UPDATE sites
+		SET deleted_at = NULL, updated_at = $1
+		WHERE id = $2
+	`
+	if _, err = tx.ExecContext(ctx, stmt, time.Now(), siteID); err != nil {
+		return err
+	}
+
+	stmt = `
+		UPDATE posts
+		SET deleted_at = NULL
+		WHERE site_id = $1 AND deleted_at = $2
+	`
+	if _, err = tx.ExecContext(ctx, stmt, siteID, deletedAt); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
 
 	return nil
 }
+
+// IsSubdirectoryTaken reports whether another site uses subdirectory. Trashed
+// sites count, since they get their subdirectory back when restored.
+func (s *Store) IsSubdirectoryTaken(subdirectory, siteID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var taken bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sites
+			WHERE subdirectory = $1 AND id <> $2
+		)
+	`
+	err := s.db.QueryRowContext(ctx, query, subdirectory, siteID).Scan(&taken)
+	if err != nil {
+		return false, err
+	}
+
+	return taken, nil
+}
+
+// PurgeTrash permanently deletes sites that were trashed before the cutoff.
+// Their posts go with them.
+func (s *Store) PurgeTrash(before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	stmt := `
+		DELETE FROM sites
+		WHERE deleted_at < $1
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetSitemapChunks splits the published posts of a site into sitemap files
+// of at most size URLs and returns the latest modification of each file.
+func (s *Store) GetSitemapChunks(siteID string, size int) ([]time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT MAX(updated_at)
+		FROM (
+			SELECT
+				COALESCE(updated_at, created_at) AS updated_at,
+				(ROW_NUMBER() OVER (ORDER BY created_at, id) - 1) / $3 AS chunk
+			FROM posts
+			WHERE site_id = $1 AND status = 'published' AND published_at <= $2
+				AND deleted_at IS NULL
+		) p
+		GROUP BY chunk
+		ORDER BY chunk
+	`
+	rows, err := s.db.QueryContext(ctx, query, siteID, time.Now(), size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chunks []time.Time
+	for rows.Next() {
+		var lastMod time.Time
+		if err := rows.Scan(&lastMod); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, lastMod)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return chunks, nil
+}
+
+func (s *Store) GetSitemapEntries(
+	siteID string,
+	offset, limit int,
+) ([]models.SitemapEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT slug, COALESCE(updated_at, created_at)
+		FROM posts
+		WHERE site_id = $1 AND status = 'published' AND published_at <= $2
+			AND deleted_at IS NULL
+		ORDER BY created_at, id
+		OFFSET $3
+		LIMIT $4
+	`
+	rows, err := s.db.QueryContext(ctx, query, siteID, time.Now(), offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.SitemapEntry
+	for rows.Next() {
+		var entry models.SitemapEntry
+		if err := rows.Scan(&entry.Slug, &entry.UpdatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,394 @@
+package subscribers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/mail"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+)
+
+type Handler struct {
+	store  models.SubscriberStore
+	sender mail.Sender
+}
+
+func NewHandler(store models.SubscriberStore, sender mail.Sender) *Handler {
+	return &Handler{
+		store:  store,
+		sender: sender,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/{siteID}/subscribers", h.GetSubscribers).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/subscribers/export.csv", h.ExportSubscribers).
+		Methods(http.MethodGet)
+
+	// confirm and unsubscribe are links in mails, so they answer GET too.
+	// Link scanners follow those, so GET only asks to confirm and the change
+	// happens on POST, which is also what one-click unsubscribe (RFC 8058)
+	// sends
+	publicRouter := router.NewRoute().Subrouter()
+	publicRouter.HandleFunc("/sites/{subdirectory}/subscribers", h.CreateSubscriber).
+		Methods(http.MethodPost)
+	publicRouter.HandleFunc("/subscribers/confirm/{token}", h.ConfirmSubscription).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/subscribers/confirm/{token}", h.ConfirmSubscriber).
+		Methods(http.MethodPost)
+	publicRouter.HandleFunc("/subscribers/unsubscribe/{token}", h.ConfirmUnsubscribe).
+		Methods(http.MethodGet)
+	publicRouter.HandleFunc("/subscribers/unsubscribe/{token}", h.Unsubscribe).
+		Methods(http.MethodPost)
+}
+
+func (h *Handler) CreateSubscriber(w http.ResponseWriter, r *http.Request) {
+	subdirectory := mux.Vars(r)["subdirectory"]
+
+	newSubscriber := new(models.CreateSubscriberPayload)
+	helpers.DecodeJSONBody(w, r, newSubscriber)
+	newSubscriber.Email = strings.ToLower(strings.TrimSpace(newSubscriber.Email))
+
+	if err := helpers.Validate.Struct(newSubscriber); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid Payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	confirmation, err := h.store.CreateSubscriber(subdirectory, newSubscriber.Email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if confirmation != nil {
+		confirmURL := fmt.Sprintf(
+			"%v/subscribers/confirm/%v",
+			helpers.APIRootURL(r, "/sites/"+subdirectory+"/subscribers"),
+			confirmation.Token,
+		)
+		err = h.sender.Send(mail.Message{
+			To:      confirmation.Email,
+			Subject: fmt.Sprintf("Confirm your subscription to %v", confirmation.SiteName),
+			Text: fmt.Sprintf(
+				"Please confirm that you want to get new posts from %v by email:\n\n%v\n\n"+
+					"If you did not sign up, ignore this mail and you won't hear from us again.\n",
+				confirmation.SiteName,
+				confirmURL,
+			),
+		})
+		if err != nil {
+			// the mail server's answer is no business of the reader's
+			log.Printf("Failed to send confirmation to %v: %v", confirmation.Email, err)
+			if err = h.store.ReleaseConfirmation(confirmation.Token); err != nil {
+				log.Printf("Failed to release confirmation for %v: %v", confirmation.Email, err)
+			}
+			helpers.WriteJSONError(
+				w,
+				http.StatusServiceUnavailable,
+				"Could not send the confirmation mail, please try again later",
+			)
+			return
+		}
+	}
+
+	// the answer is the same for known addresses, so the form doesn't reveal
+	// who is subscribed
+	helpers.WriteJSONSuccess(
+		w,
+		http.StatusAccepted,
+		"Check your inbox to confirm your subscription",
+		nil,
+	)
+}
+
+// ConfirmSubscription is the page the confirmation link in a mail opens. It
+// changes nothing, its button posts back to the same address.
+func (h *Handler) ConfirmSubscription(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	siteName, err := h.store.GetConfirmationSiteName(token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writePage(w, http.StatusNotFound, "Confirmation link is invalid or has expired", "")
+			return
+		}
+		log.Println("Failed to load subscription:", err)
+		writePage(w, http.StatusInternalServerError, "Something went wrong", "")
+		return
+	}
+
+	writePage(
+		w,
+		http.StatusOK,
+		"Subscribe to "+siteName+"?",
+		`<form method="post">`+
+			`<button type="submit">Confirm subscription</button>`+
+			`</form>`,
+	)
+}
+
+// ConfirmSubscriber answers the form of ConfirmSubscription with a page and
+// API clients with JSON.
+func (h *Handler) ConfirmSubscriber(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	page := strings.Contains(r.Header.Get("Accept"), "text/html")
+
+	subscriber, err := h.store.ConfirmSubscriber(token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			if page {
+				writePage(w, http.StatusNotFound, "Confirmation link is invalid or has expired", "")
+				return
+			}
+			helpers.WriteJSONError(
+				w,
+				http.StatusNotFound,
+				"Confirmation link is invalid or has expired",
+			)
+			return
+		}
+		if page {
+			log.Println("Failed to confirm subscription:", err)
+			writePage(w, http.StatusInternalServerError, "Something went wrong", "")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if page {
+		writePage(w, http.StatusOK, "Subscription confirmed", "")
+		return
+	}
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Subscription confirmed", subscriber)
+}
+
+// ConfirmUnsubscribe is the page the unsubscribe link in a mail opens. It
+// changes nothing, its button posts back to the same address.
+func (h *Handler) ConfirmUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	siteName, err := h.store.GetUnsubscribeSiteName(token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writePage(w, http.StatusNotFound, "Subscription not found", "")
+			return
+		}
+		log.Println("Failed to load subscription:", err)
+		writePage(w, http.StatusInternalServerError, "Something went wrong", "")
+		return
+	}
+
+	writePage(
+		w,
+		http.StatusOK,
+		"Unsubscribe from "+siteName+"?",
+		`<form method="post">`+
+			`<input type="hidden" name="List-Unsubscribe" value="One-Click">`+
+			`<button type="submit">Unsubscribe</button>`+
+			`</form>`,
+	)
+}
+
+// Unsubscribe answers the form of ConfirmUnsubscribe with a page and API
+// clients and one-click unsubscribe with JSON.
+func (h *Handler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	page := strings.Contains(r.Header.Get("Accept"), "text/html")
+
+	if err := h.store.Unsubscribe(token); err != nil {
+		if err == sql.ErrNoRows {
+			if page {
+				writePage(w, http.StatusNotFound, "Subscription not found", "")
+				return
+			}
+			helpers.WriteJSONError(w, http.StatusNotFound, "Subscription not found")
+			return
+		}
+		if page {
+			log.Println("Failed to unsubscribe:", err)
+			writePage(w, http.StatusInternalServerError, "Something went wrong", "")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	if page {
+		writePage(w, http.StatusOK, "You have been unsubscribed", "")
+		return
+	}
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Unsubscribed successfully", nil)
+}
+
+// writePage writes a minimal HTML page for readers who follow a link from a
+// mail. body is written as is, title is escaped.
+func writePage(w http.ResponseWriter, status int, title, body string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	fmt.Fprintf(
+		w,
+		"<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%v</title></head>\n"+
+			"<body>\n<h1>%v</h1>\n%v\n</body>\n</html>\n",
+		html.EscapeString(title),
+		html.EscapeString(title),
+		body,
+	)
+}
+
+func (h *Handler) GetSubscribers(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.SubscriberStatusConfirmed
+	case models.SubscriberStatusPending,
+		models.SubscriberStatusConfirmed,
+		models.SubscriberStatusUnsubscribed:
+	default:
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			"Status must be one of pending, confirmed or unsubscribed",
+		)
+		return
+	}
+
+	page, err := pagination.FromRequest(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subscribers, nextPage, err := h.store.GetSubscribers(siteID, userID, status, page)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONPage(
+		w,
+		http.StatusOK,
+		"Subscribers fetched successfully",
+		subscribers,
+		nextPage,
+	)
+}
+
+func (h *Handler) ExportSubscribers(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subscribers, err := h.store.GetAllSubscribers(siteID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscribers.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"email", "status", "created_at", "confirmed_at", "unsubscribed_at"})
+	for _, subscriber := range subscribers {
+		writer.Write([]string{
+			csvSafe(subscriber.Email),
+			subscriber.Status,
+			subscriber.CreatedAt.Format(time.RFC3339),
+			formatOptionalTime(subscriber.ConfirmedAt),
+			formatOptionalTime(subscriber.UnsubscribedAt),
+		})
+	}
+	writer.Flush()
+}
+
+// csvSafe keeps spreadsheets from reading a value as a formula. Addresses
+// like "=cmd@example.com" are valid, so they can come from any reader.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+
+	return value
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func getUserIDAndSiteID(r *http.Request) (string, string, error) {
+	userID := r.Context().Value("userID").(string)
+	siteID := mux.Vars(r)["siteID"]
+
+	if userID == "" {
+		return userID, siteID, errors.New("User not found")
+	}
+
+	if siteID == "" {
+		return userID, siteID, errors.New("Site not found")
+	}
+
+	return userID, siteID, nil
+}
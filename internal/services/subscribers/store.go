@@ -0,0 +1,504 @@
+package subscribers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/pagination"
+)
+
+const (
+	// confirmation links stop working after confirmTokenTTL
+	confirmTokenTTL = 72 * time.Hour
+	// signing up again resends the confirmation at most every
+	// confirmResendInterval, so the form can't be used to flood an inbox
+	confirmResendInterval = 10 * time.Minute
+)
+
+// MaxDeliveryAttempts is how often a post is sent to a subscriber before the
+// newsletter gives up on the address.
+const MaxDeliveryAttempts = 5
+
+// deliveryRetryDelay backs off exponentially from five minutes, capped at six
+// hours.
+func deliveryRetryDelay(attempts int) time.Duration {
+	return min(5*time.Minute<<min(attempts, 6), 6*time.Hour)
+}
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		db: db,
+	}
+}
+
+func newToken() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(random), nil
+}
+
+// CreateSubscriber adds email to the site's list as pending and returns what
+// the confirmation mail needs. It returns nil when no mail should go out,
+// because the address is already confirmed or was sent a link just now.
+func (s *Store) CreateSubscriber(
+	subdirectory, email string,
+) (*models.SubscriberConfirmation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var siteID, siteName string
+	query := `
+		SELECT id, name FROM sites
+		WHERE subdirectory = $1 AND deleted_at IS NULL
+	`
+	err := s.db.QueryRowContext(ctx, query, subdirectory).Scan(&siteID, &siteName)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	confirmToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	unsubscribeToken, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	stmt := `
+		INSERT INTO subscribers
+			(id, site_id, email, status, confirm_token, unsubscribe_token, created_at, confirm_sent_at)
+		VALUES
+			($1, $2, $3, 'pending', $4, $5, $6, $6)
+		ON CONFLICT (site_id, email) DO UPDATE
+		SET
+			status = 'pending',
+			confirm_token = EXCLUDED.confirm_token,
+			confirm_sent_at = EXCLUDED.confirm_sent_at,
+			unsubscribed_at = NULL
+		WHERE subscribers.status = 'unsubscribed'
+			OR (
+				subscribers.status = 'pending'
+				AND (subscribers.confirm_sent_at IS NULL OR subscribers.confirm_sent_at < $7)
+			)
+		RETURNING confirm_token
+	`
+	err = s.db.QueryRowContext(ctx, stmt,
+		id,
+		siteID,
+		email,
+		confirmToken,
+		unsubscribeToken,
+		now,
+		now.Add(-confirmResendInterval),
+	).Scan(&confirmToken)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &models.SubscriberConfirmation{
+		Email:    email,
+		SiteName: siteName,
+		Token:    confirmToken,
+	}, nil
+}
+
+// ReleaseConfirmation forgets that a confirmation mail went out, after it
+// could not be sent, so signing up again sends it right away.
+func (s *Store) ReleaseConfirmation(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE subscribers
+		SET confirm_sent_at = NULL
+		WHERE confirm_token = $1 AND status = 'pending'
+	`
+	_, err := s.db.ExecContext(ctx, stmt, token)
+	return err
+}
+
+// GetConfirmationSiteName returns the name of the site a pending
+// subscriber owning token is signing up to, for the page asking to confirm
+// the subscription. Tokens ConfirmSubscriber would reject are not found.
+func (s *Store) GetConfirmationSiteName(token string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var siteName string
+	query := `
+		SELECT s.name
+		FROM subscribers sub
+		INNER JOIN sites s
+		ON sub.site_id = s.id
+		WHERE sub.confirm_token = $1 AND sub.status = 'pending' AND sub.confirm_sent_at > $2
+			AND s.deleted_at IS NULL
+	`
+	err := s.db.QueryRowContext(ctx, query, token, time.Now().Add(-confirmTokenTTL)).
+		Scan(&siteName)
+	if err != nil {
+		return "", err
+	}
+
+	return siteName, nil
+}
+
+func (s *Store) ConfirmSubscriber(token string) (*models.Subscriber, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	stmt := `
+		UPDATE subscribers
+		SET status = 'confirmed', confirm_token = NULL, confirmed_at = $2
+		WHERE confirm_token = $1 AND status = 'pending' AND confirm_sent_at > $3
+			AND site_id IN (SELECT id FROM sites WHERE deleted_at IS NULL)
+		RETURNING id, site_id, email, status, created_at, confirmed_at, unsubscribed_at
+	`
+	subscriber := new(models.Subscriber)
+	err := s.db.QueryRowContext(ctx, stmt, token, now, now.Add(-confirmTokenTTL)).Scan(
+		&subscriber.ID,
+		&subscriber.SiteID,
+		&subscriber.Email,
+		&subscriber.Status,
+		&subscriber.CreatedAt,
+		&subscriber.ConfirmedAt,
+		&subscriber.UnsubscribedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriber, nil
+}
+
+// GetUnsubscribeSiteName returns the name of the site the subscriber owning
+// token is on, for the page asking to confirm the unsubscribe.
+func (s *Store) GetUnsubscribeSiteName(token string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var siteName string
+	query := `
+		SELECT s.name
+		FROM subscribers sub
+		INNER JOIN sites s
+		ON sub.site_id = s.id
+		WHERE sub.unsubscribe_token = $1
+	`
+	err := s.db.QueryRowContext(ctx, query, token).Scan(&siteName)
+	if err != nil {
+		return "", err
+	}
+
+	return siteName, nil
+}
+
+// Unsubscribe takes the subscriber owning token off the list. Unsubscribing
+// twice is not an error, mail clients may follow the link more than once.
+func (s *Store) Unsubscribe(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		UPDATE subscribers
+		SET
+			status = 'unsubscribed',
+			confirm_token = NULL,
+			unsubscribed_at = COALESCE(unsubscribed_at, $2)
+		WHERE unsubscribe_token = $1
+	`
+	result, err := s.db.ExecContext(ctx, stmt, token, time.Now())
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) GetSubscribers(
+	siteID, userID, status string,
+	page pagination.Params,
+) ([]models.Subscriber, pagination.Page, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			sub.id, sub.site_id, sub.email, sub.status, sub.created_at, sub.confirmed_at,
+			sub.unsubscribed_at
+		FROM subscribers sub
+		INNER JOIN sites s
+		ON sub.site_id = s.id
+		WHERE sub.site_id = $1 AND s.user_id = $2 AND sub.status = $3
+	`
+	clause, args := page.Clause("sub.created_at", "sub.id", []any{siteID, userID, status})
+
+	rows, err := s.db.QueryContext(ctx, query+clause, args...)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+	defer rows.Close()
+
+	subscribers, err := scanSubscribers(rows)
+	if err != nil {
+		return nil, pagination.Page{}, err
+	}
+
+	subscribers, nextPage := pagination.Trim(
+		subscribers,
+		page,
+		func(subscriber models.Subscriber) pagination.Cursor {
+			return pagination.Cursor{CreatedAt: subscriber.CreatedAt, ID: subscriber.ID}
+		},
+	)
+	return subscribers, nextPage, nil
+}
+
+// GetAllSubscribers lists every subscriber of a site, oldest first, for the
+// export. It returns sql.ErrNoRows when the user does not own the site.
+func (s *Store) GetAllSubscribers(siteID, userID string) ([]models.Subscriber, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var owned bool
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM sites
+			WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL
+		)
+	`
+	err := s.db.QueryRowContext(ctx, query, siteID, userID).Scan(&owned)
+	if err != nil {
+		return nil, err
+	}
+	if !owned {
+		return nil, sql.ErrNoRows
+	}
+
+	query = `
+		SELECT id, site_id, email, status, created_at, confirmed_at, unsubscribed_at
+		FROM subscribers
+		WHERE site_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := s.db.QueryContext(ctx, query, siteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubscribers(rows)
+}
+
+func scanSubscribers(rows *sql.Rows) ([]models.Subscriber, error) {
+	subscribers := []models.Subscriber{}
+	for rows.Next() {
+		var subscriber models.Subscriber
+		err := rows.Scan(
+			&subscriber.ID,
+			&subscriber.SiteID,
+			&subscriber.Email,
+			&subscriber.Status,
+			&subscriber.CreatedAt,
+			&subscriber.ConfirmedAt,
+			&subscriber.UnsubscribedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, subscriber)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscribers, nil
+}
+
+// GetPendingDeliveries pairs posts published since the cutoff with the
+// confirmed subscribers that have not been sent them yet. Readers who
+// subscribed after a post went out don't get it. Failed deliveries come back
+// once their retry delay is over, after the ones never tried, so addresses
+// that keep bouncing don't hold up the rest.
+func (s *Store) GetPendingDeliveries(
+	since time.Time,
+	limit int,
+) ([]models.NewsletterDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT
+			p.id, p.title, p.small_description, p.slug, p.article_content, p.members_only,
+			st.name, st.subdirectory, sub.id, sub.email, sub.unsubscribe_token
+		FROM posts p
+		INNER JOIN sites st
+		ON p.site_id = st.id
+		INNER JOIN subscribers sub
+		ON sub.site_id = p.site_id
+		LEFT JOIN newsletter_deliveries d
+		ON d.post_id = p.id AND d.subscriber_id = sub.id
+		WHERE p.status = 'published' AND p.published_at <= $1 AND p.published_at >= $2
+			AND p.deleted_at IS NULL AND st.deleted_at IS NULL
+			AND sub.status = 'confirmed' AND sub.confirmed_at <= p.published_at
+			AND (
+				d.post_id IS NULL
+				OR (d.sent_at IS NULL AND d.attempts < $4 AND d.retry_at <= $1)
+			)
+		ORDER BY COALESCE(d.attempts, 0), p.published_at, p.id, sub.id
+		LIMIT $3
+	`
+	rows, err := s.db.QueryContext(ctx, query, time.Now(), since, limit, MaxDeliveryAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.NewsletterDelivery
+	for rows.Next() {
+		var delivery models.NewsletterDelivery
+		var marshalledArticleContent []byte
+		err := rows.Scan(
+			&delivery.PostID,
+			&delivery.Title,
+			&delivery.SmallDescription,
+			&delivery.Slug,
+			&marshalledArticleContent,
+			&delivery.MembersOnly,
+			&delivery.SiteName,
+			&delivery.Subdirectory,
+			&delivery.SubscriberID,
+			&delivery.Email,
+			&delivery.UnsubscribeToken,
+		)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(marshalledArticleContent, &delivery.ArticleContent)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDelivery records that a post is being sent to a subscriber. It reports
+// false when someone else got there first, so each reader gets a post once.
+// A failed delivery can be claimed again once its retry delay is over.
+func (s *Store) ClaimDelivery(postID, subscriberID string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		INSERT INTO newsletter_deliveries (post_id, subscriber_id, sent_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, subscriber_id) DO UPDATE
+		SET sent_at = EXCLUDED.sent_at, retry_at = NULL
+		WHERE newsletter_deliveries.sent_at IS NULL
+			AND newsletter_deliveries.attempts < $4
+			AND newsletter_deliveries.retry_at <= EXCLUDED.sent_at
+	`
+	result, err := s.db.ExecContext(
+		ctx,
+		stmt,
+		postID,
+		subscriberID,
+		time.Now(),
+		MaxDeliveryAttempts,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// FailDelivery records that a claimed mail could not be sent and when to try
+// again. It reports true when this was the last attempt and the newsletter
+// gives up on the address for this post.
+func (s *Store) FailDelivery(postID, subscriberID, reason string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var attempts int
+	query := `
+		SELECT attempts FROM newsletter_deliveries
+		WHERE post_id = $1 AND subscriber_id = $2
+		FOR UPDATE
+	`
+	err = tx.QueryRowContext(ctx, query, postID, subscriberID).Scan(&attempts)
+	if err != nil {
+		return false, err
+	}
+	attempts++
+
+	stmt := `
+		UPDATE newsletter_deliveries
+		SET sent_at = NULL, attempts = $3, last_error = $4, retry_at = $5
+		WHERE post_id = $1 AND subscriber_id = $2
+	`
+	_, err = tx.ExecContext(
+		ctx,
+		stmt,
+		postID,
+		subscriberID,
+		attempts,
+		reason,
+		time.Now().Add(deliveryRetryDelay(attempts)),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, err
+	}
+	return attempts >= MaxDeliveryAttempts, nil
+}
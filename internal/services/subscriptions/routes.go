@@ -23,9 +23,11 @@ func NewHandler(store models.SubscriptionStore) *Handler {
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.Use(middleware.WithAuth)
-	router.HandleFunc("/subscriptions/status", h.CheckSubscriptionStatus).Methods(http.MethodGet)
-	router.HandleFunc("/subscriptions", h.GetSubscriptionDetails).Methods(http.MethodGet)
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/subscriptions/status", h.CheckSubscriptionStatus).
+		Methods(http.MethodGet)
+	authRouter.HandleFunc("/subscriptions", h.GetSubscriptionDetails).Methods(http.MethodGet)
 }
 
 func (h *Handler) GetSubscriptionDetails(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,211 @@
+package tags
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
+	"github.com/mznrasil/my-blogs-be/internal/models"
+)
+
+type Handler struct {
+	store models.TagStore
+}
+
+func NewHandler(store models.TagStore) *Handler {
+	return &Handler{
+		store: store,
+	}
+}
+
+func (h *Handler) RegisterRoutes(router *mux.Router) {
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/{siteID}/tags", h.GetAllTags).Methods(http.MethodGet)
+	authRouter.HandleFunc("/{siteID}/tags", h.CreateTag).Methods(http.MethodPost)
+	authRouter.HandleFunc("/{siteID}/tags/{tagID}", h.UpdateTag).Methods(http.MethodPatch)
+	authRouter.HandleFunc("/{siteID}/tags/{tagID}", h.DeleteTag).Methods(http.MethodDelete)
+}
+
+func (h *Handler) GetAllTags(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags, err := h.store.GetTagsBySiteID(siteID, userID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Tags fetched successfully", tags)
+}
+
+func (h *Handler) CreateTag(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	newTag := new(models.CreateTagPayload)
+	helpers.DecodeJSONBody(w, r, newTag)
+
+	if err := helpers.Validate.Struct(newTag); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid Payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	slug := helpers.TopicSlug(newTag.Name)
+	if slug == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Tag name must contain letters or digits")
+		return
+	}
+
+	existing, err := h.store.GetTagBySlug(slug, siteID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if existing != nil {
+		helpers.WriteJSONError(w, http.StatusConflict, "Tag with this name already exists")
+		return
+	}
+
+	tag, err := h.store.CreateTag(*newTag, siteID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Site not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusCreated, "Tag created successfully", tag)
+}
+
+func (h *Handler) UpdateTag(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tagID := mux.Vars(r)["tagID"]
+	if tagID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Tag ID not found")
+		return
+	}
+
+	tagPayload := new(models.CreateTagPayload)
+	helpers.DecodeJSONBody(w, r, tagPayload)
+
+	if err := helpers.Validate.Struct(tagPayload); err != nil {
+		errors := err.(validator.ValidationErrors)
+		helpers.WriteJSONError(
+			w,
+			http.StatusBadRequest,
+			fmt.Sprintf("Invalid payload: %v", errors.Error()),
+		)
+		return
+	}
+
+	slug := helpers.TopicSlug(tagPayload.Name)
+	if slug == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Tag name must contain letters or digits")
+		return
+	}
+
+	existing, err := h.store.GetTagBySlug(slug, siteID)
+	if err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+	if existing != nil && existing.ID != tagID {
+		helpers.WriteJSONError(w, http.StatusConflict, "Tag with this name already exists")
+		return
+	}
+
+	if err = h.store.UpdateTag(*tagPayload, tagID, siteID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			helpers.WriteJSONError(w, http.StatusNotFound, "Tag not found")
+			return
+		}
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Tag updated successfully", nil)
+}
+
+func (h *Handler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	userID, siteID, err := getUserIDAndSiteID(r)
+	if err != nil {
+		helpers.WriteJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tagID := mux.Vars(r)["tagID"]
+	if tagID == "" {
+		helpers.WriteJSONError(w, http.StatusBadRequest, "Tag ID not found")
+		return
+	}
+
+	if err := h.store.DeleteTag(tagID, siteID, userID); err != nil {
+		helpers.WriteJSONError(
+			w,
+			http.StatusInternalServerError,
+			fmt.Sprintf("Server error: %v", err.Error()),
+		)
+		return
+	}
+
+	helpers.WriteJSONSuccess(w, http.StatusOK, "Tag deleted successfully", nil)
+}
+
+func getUserIDAndSiteID(r *http.Request) (string, string, error) {
+	userID := r.Context().Value("userID").(string)
+	siteID := mux.Vars(r)["siteID"]
+
+	if userID == "" {
+		return userID, siteID, errors.New("User not found")
+	}
+
+	if siteID == "" {
+		return userID, siteID, errors.New("Site not found")
+	}
+
+	return userID, siteID, nil
+}
@@ -0,0 +1,74 @@
+package tags
+
+import (
+	"database/sql"
+
+	"github.com/mznrasil/my-blogs-be/internal/models"
+	"github.com/mznrasil/my-blogs-be/internal/services/topics"
+)
+
+type Store struct {
+	topics *topics.Store
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{
+		topics: topics.NewStore(db, topics.Tags),
+	}
+}
+
+func toTag(topic topics.Topic) models.Tag {
+	return models.Tag{
+		ID:        topic.ID,
+		Name:      topic.Name,
+		Slug:      topic.Slug,
+		SiteID:    topic.SiteID,
+		CreatedAt: topic.CreatedAt,
+		UpdatedAt: topic.UpdatedAt,
+	}
+}
+
+func (s *Store) GetTagsBySiteID(siteID, userID string) ([]models.Tag, error) {
+	topics, err := s.topics.GetTopicsBySiteID(siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []models.Tag
+	for _, topic := range topics {
+		tags = append(tags, toTag(topic))
+	}
+
+	return tags, nil
+}
+
+func (s *Store) GetTagBySlug(slug, siteID string) (*models.Tag, error) {
+	topic, err := s.topics.GetTopicBySlug(slug, siteID)
+	if err != nil || topic == nil {
+		return nil, err
+	}
+
+	tag := toTag(*topic)
+	return &tag, nil
+}
+
+func (s *Store) CreateTag(
+	newTag models.CreateTagPayload,
+	siteID, userID string,
+) (*models.Tag, error) {
+	topic, err := s.topics.CreateTopic(newTag.Name, "", siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := toTag(*topic)
+	return &tag, nil
+}
+
+func (s *Store) UpdateTag(tag models.CreateTagPayload, tagID, siteID, userID string) error {
+	return s.topics.UpdateTopic(tag.Name, "", tagID, siteID, userID)
+}
+
+func (s *Store) DeleteTag(tagID, siteID, userID string) error {
+	return s.topics.DeleteTopic(tagID, siteID, userID)
+}
@@ -0,0 +1,216 @@
+// Package topics stores the tags and categories posts are filed under. Both
+// live in tables of the same shape, scoped to a site and unique by slug;
+// categories also carry a description.
+package topics
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mznrasil/my-blogs-be/internal/helpers"
+)
+
+type Topic struct {
+	ID          string
+	Name        string
+	Slug        string
+	Description string
+	SiteID      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Kind struct {
+	table          string
+	hasDescription bool
+}
+
+var (
+	Tags       = Kind{table: "tags"}
+	Categories = Kind{table: "categories", hasDescription: true}
+)
+
+type Store struct {
+	db   *sql.DB
+	kind Kind
+}
+
+func NewStore(db *sql.DB, kind Kind) *Store {
+	return &Store{
+		db:   db,
+		kind: kind,
+	}
+}
+
+// columns are the columns scanTopic reads, prefixed with alias when it is set.
+func (s *Store) columns(alias string) string {
+	if alias != "" {
+		alias += "."
+	}
+
+	description := "''"
+	if s.kind.hasDescription {
+		description = "COALESCE(" + alias + "description, '')"
+	}
+
+	return alias + "id, " + alias + "name, " + alias + "slug, " + description + ", " +
+		alias + "site_id, " + alias + "created_at, " + alias + "updated_at"
+}
+
+func scanTopic(scan func(dest ...any) error) (Topic, error) {
+	var topic Topic
+	err := scan(
+		&topic.ID,
+		&topic.Name,
+		&topic.Slug,
+		&topic.Description,
+		&topic.SiteID,
+		&topic.CreatedAt,
+		&topic.UpdatedAt,
+	)
+	return topic, err
+}
+
+func (s *Store) GetTopicsBySiteID(siteID, userID string) ([]Topic, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + s.columns("t") + `
+		FROM ` + s.kind.table + ` t
+		INNER JOIN sites s
+		ON t.site_id = s.id
+		WHERE t.site_id = $1 AND s.user_id = $2
+		ORDER BY t.name;
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, siteID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var topics []Topic
+	for rows.Next() {
+		topic, err := scanTopic(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, topic)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return topics, nil
+}
+
+func (s *Store) GetTopicBySlug(slug, siteID string) (*Topic, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT ` + s.columns("") + `
+		FROM ` + s.kind.table + `
+		WHERE slug = $1 AND site_id = $2
+	`
+
+	topic, err := scanTopic(s.db.QueryRowContext(ctx, query, slug, siteID).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &topic, nil
+}
+
+func (s *Store) CreateTopic(name, description, siteID, userID string) (*Topic, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	uuid, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []any{uuid, name, helpers.TopicSlug(name), time.Now(), siteID, userID}
+	columns, values := "id, name, slug, created_at, updated_at", "$1, $2, $3, $4, $4"
+	if s.kind.hasDescription {
+		args = append(args, description)
+		columns, values = columns+", description", values+", $7"
+	}
+
+	// selecting from sites makes the insert a no-op for sites the user does not own
+	stmt := `
+		INSERT INTO ` + s.kind.table + `
+			(` + columns + `, site_id)
+		SELECT
+			` + values + `, id
+		FROM sites
+		WHERE id = $5 AND user_id = $6
+		RETURNING ` + s.columns("")
+
+	topic, err := scanTopic(s.db.QueryRowContext(ctx, stmt, args...).Scan)
+	if err != nil {
+		return nil, err
+	}
+
+	return &topic, nil
+}
+
+func (s *Store) UpdateTopic(name, description, topicID, siteID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	args := []any{name, helpers.TopicSlug(name), time.Now(), topicID, siteID, userID}
+	set := "name = $1, slug = $2, updated_at = $3"
+	if s.kind.hasDescription {
+		args = append(args, description)
+		set += ", description = $7"
+	}
+
+	stmt := `
+		UPDATE ` + s.kind.table + ` t
+		SET ` + set + `
+		FROM sites s
+		WHERE t.site_id = s.id AND t.id = $4 AND t.site_id = $5 AND s.user_id = $6
+	`
+
+	result, err := s.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *Store) DeleteTopic(topicID, siteID, userID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stmt := `
+		DELETE FROM ` + s.kind.table + ` t
+		USING sites s
+		WHERE t.site_id = s.id AND t.id = $1 AND t.site_id = $2 AND s.user_id = $3
+	`
+
+	_, err := s.db.ExecContext(ctx, stmt, topicID, siteID, userID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"github.com/mznrasil/my-blogs-be/internal/helpers"
+	"github.com/mznrasil/my-blogs-be/internal/middleware"
 	"github.com/mznrasil/my-blogs-be/internal/models"
 )
 
@@ -23,11 +24,14 @@ func NewHandler(store models.UserStore) *Handler {
 }
 
 func (h Handler) RegisterRoutes(router *mux.Router) {
+	authRouter := router.NewRoute().Subrouter()
+	authRouter.Use(middleware.WithAuth)
+	authRouter.HandleFunc("/users/{id}", h.GetUserById).Methods(http.MethodGet)
+	authRouter.HandleFunc("/users/{id}", h.UpdateCustomerId).Methods(http.MethodPatch)
+	authRouter.HandleFunc("/customers/{id}", h.GetCustomerById).Methods(http.MethodGet)
+
 	publicRouter := router.NewRoute().Subrouter()
 	publicRouter.HandleFunc("/users", h.CreateUser).Methods(http.MethodPost)
-	publicRouter.HandleFunc("/users/{id}", h.GetUserById).Methods(http.MethodGet)
-	publicRouter.HandleFunc("/users/{id}", h.UpdateCustomerId).Methods(http.MethodPatch)
-	publicRouter.HandleFunc("/customers/{id}", h.GetCustomerById).Methods(http.MethodGet)
 }
 
 func (h Handler) GetCustomerById(w http.ResponseWriter, r *http.Request) {
@@ -39,6 +43,10 @@ func (h Handler) GetCustomerById(w http.ResponseWriter, r *http.Request) {
 	}
 
 	customer, err := h.store.GetCustomerById(customerID)
+	// other users' customers are reported as missing
+	if err == nil && customer.ID != r.Context().Value("userID").(string) {
+		err = sql.ErrNoRows
+	}
 	if err != nil {
 		if err == sql.ErrNoRows {
 			helpers.WriteJSONError(
@@ -66,6 +74,10 @@ func (h Handler) UpdateCustomerId(w http.ResponseWriter, r *http.Request) {
 		helpers.WriteJSONError(w, http.StatusBadRequest, "User ID not provided")
 		return
 	}
+	if userID != r.Context().Value("userID").(string) {
+		helpers.WriteJSONError(w, http.StatusForbidden, "Users can only update themselves")
+		return
+	}
 
 	var data struct {
 		CustomerID string `json:"customer_id"`
@@ -130,6 +142,10 @@ func (h Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
 func (h Handler) GetUserById(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
+	if id != r.Context().Value("userID").(string) {
+		helpers.WriteJSONError(w, http.StatusForbidden, "Users can only view themselves")
+		return
+	}
 
 	user, err := h.store.GetUserByID(id)
 	if err != nil {
@@ -0,0 +1,70 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// MaxURLs is the most URLs the sitemap protocol allows in a single file.
+// Larger sites are split into several files listed by a sitemap index.
+const MaxURLs = 50000
+
+const namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type URL struct {
+	Loc     string
+	LastMod time.Time
+}
+
+type urlSet struct {
+	XMLName xml.Name   `xml:"urlset"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	URLs    []location `xml:"url"`
+}
+
+type index struct {
+	XMLName  xml.Name   `xml:"sitemapindex"`
+	XMLNS    string     `xml:"xmlns,attr"`
+	Sitemaps []location `xml:"sitemap"`
+}
+
+type location struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func URLSet(urls []URL) ([]byte, error) {
+	set := urlSet{XMLNS: namespace, URLs: []location{}}
+	for _, url := range urls {
+		set.URLs = append(set.URLs, newLocation(url))
+	}
+
+	return encode(set)
+}
+
+func Index(sitemaps []URL) ([]byte, error) {
+	sitemapIndex := index{XMLNS: namespace, Sitemaps: []location{}}
+	for _, sitemap := range sitemaps {
+		sitemapIndex.Sitemaps = append(sitemapIndex.Sitemaps, newLocation(sitemap))
+	}
+
+	return encode(sitemapIndex)
+}
+
+func newLocation(url URL) location {
+	loc := location{Loc: url.Loc}
+	if !url.LastMod.IsZero() {
+		loc.LastMod = url.LastMod.Format(time.RFC3339)
+	}
+
+	return loc
+}
+
+func encode(v any) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS posts_site_id_status_published_at_idx;
+
+ALTER TABLE posts
+DROP COLUMN published_at,
+DROP COLUMN status;
+
+DROP TYPE post_status;
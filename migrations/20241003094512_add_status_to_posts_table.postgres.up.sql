@@ -0,0 +1,11 @@
+CREATE TYPE post_status AS ENUM ('draft', 'published', 'scheduled', 'archived');
+
+ALTER TABLE posts
+ADD COLUMN status post_status NOT NULL DEFAULT 'draft',
+ADD COLUMN published_at TIMESTAMP;
+
+-- Everything written before this migration was already public
+UPDATE posts
+SET status = 'published', published_at = created_at;
+
+CREATE INDEX posts_site_id_status_published_at_idx ON posts (site_id, status, published_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS posts_scheduled_published_at_idx;
+DROP TABLE post_publish_events;
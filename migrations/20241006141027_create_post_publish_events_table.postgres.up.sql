@@ -0,0 +1,15 @@
+CREATE TABLE post_publish_events (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL,
+    scheduled_for TIMESTAMP NOT NULL,
+    outcome VARCHAR(20) NOT NULL,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT NOW(),
+    CONSTRAINT post_publish_events_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX posts_scheduled_published_at_idx ON posts (published_at) WHERE status = 'scheduled';
@@ -0,0 +1,25 @@
+CREATE TABLE post_revisions (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL,
+    revision_number INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    article_content JSONB,
+    small_description VARCHAR(255),
+    image TEXT,
+    slug VARCHAR(255),
+    user_id VARCHAR(35),
+    created_at TIMESTAMP,
+    UNIQUE(post_id, revision_number),
+    CONSTRAINT post_revisions_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+-- Seed the history with the current state of every existing post
+INSERT INTO post_revisions
+    (id, post_id, revision_number, title, article_content, small_description, image, slug, user_id, created_at)
+SELECT
+    gen_random_uuid()::text, id, 1, title, article_content, small_description, image, slug, user_id, updated_at
+FROM posts;
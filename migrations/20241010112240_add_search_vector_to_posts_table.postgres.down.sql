@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS posts_search_vector_idx;
+
+ALTER TABLE posts
+DROP COLUMN search_vector;
+
+DROP FUNCTION post_article_text(JSONB);
@@ -0,0 +1,16 @@
+-- Concatenates every "text" leaf of the editor document so it can be indexed
+-- and highlighted like a plain column
+CREATE FUNCTION post_article_text(content JSONB) RETURNS TEXT
+LANGUAGE SQL IMMUTABLE PARALLEL SAFE AS $$
+    SELECT COALESCE(string_agg(t.value #>> '{}', ' '), '')
+    FROM jsonb_path_query(content, 'strict $.**.text', '{}', true) AS t(value)
+$$;
+
+ALTER TABLE posts
+ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(small_description, '')), 'B') ||
+    setweight(to_tsvector('english', post_article_text(article_content)), 'C')
+) STORED;
+
+CREATE INDEX posts_search_vector_idx ON posts USING GIN (search_vector);
@@ -0,0 +1,7 @@
+ALTER TABLE posts
+DROP CONSTRAINT IF EXISTS posts_categories_id_fk,
+DROP COLUMN category_id;
+
+DROP TABLE post_tags;
+DROP TABLE tags;
+DROP TABLE categories;
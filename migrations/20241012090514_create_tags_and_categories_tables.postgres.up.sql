@@ -0,0 +1,56 @@
+CREATE TABLE categories (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    slug VARCHAR(60) NOT NULL,
+    description VARCHAR(150),
+    site_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    UNIQUE(site_id, slug),
+    CONSTRAINT categories_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE TABLE tags (
+    id VARCHAR(36) PRIMARY KEY,
+    name VARCHAR(50) NOT NULL,
+    slug VARCHAR(60) NOT NULL,
+    site_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    UNIQUE(site_id, slug),
+    CONSTRAINT tags_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE TABLE post_tags (
+    post_id VARCHAR(36) NOT NULL,
+    tag_id VARCHAR(36) NOT NULL,
+    PRIMARY KEY (post_id, tag_id),
+    CONSTRAINT post_tags_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE,
+    CONSTRAINT post_tags_tags_id_fk
+        FOREIGN KEY (tag_id)
+        REFERENCES tags(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX post_tags_tag_id_idx ON post_tags (tag_id);
+
+ALTER TABLE posts
+ADD COLUMN category_id VARCHAR(36),
+ADD CONSTRAINT posts_categories_id_fk
+    FOREIGN KEY (category_id)
+    REFERENCES categories(id)
+    ON DELETE SET NULL
+    ON UPDATE CASCADE;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS sites_user_id_created_at_id_idx;
+DROP INDEX IF EXISTS posts_site_id_created_at_id_idx;
+DROP INDEX IF EXISTS posts_user_id_created_at_id_idx;
@@ -0,0 +1,3 @@
+CREATE INDEX posts_user_id_created_at_id_idx ON posts (user_id, created_at DESC, id DESC);
+CREATE INDEX posts_site_id_created_at_id_idx ON posts (site_id, created_at DESC, id DESC);
+CREATE INDEX sites_user_id_created_at_id_idx ON sites (user_id, created_at DESC, id DESC);
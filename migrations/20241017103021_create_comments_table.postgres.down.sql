@@ -0,0 +1,3 @@
+DROP TABLE comments;
+
+DROP TYPE comment_status;
@@ -0,0 +1,26 @@
+CREATE TYPE comment_status AS ENUM ('pending', 'approved', 'rejected', 'spam');
+
+CREATE TABLE comments (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL,
+    parent_id VARCHAR(36),
+    author_name VARCHAR(50) NOT NULL,
+    author_email VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    status comment_status NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    CONSTRAINT comments_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE,
+    CONSTRAINT comments_comments_id_fk
+        FOREIGN KEY (parent_id)
+        REFERENCES comments(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX comments_post_id_status_idx ON comments (post_id, status, created_at);
+CREATE INDEX comments_parent_id_idx ON comments (parent_id);
@@ -0,0 +1,5 @@
+DROP TABLE post_referrers_daily;
+DROP TABLE site_views_daily;
+DROP TABLE post_views_daily;
+DROP TABLE analytics_visitors;
+DROP TABLE analytics_salts;
@@ -0,0 +1,64 @@
+-- One random salt per day. Visitor hashes from earlier days cannot be
+-- linked to today's once their salt is gone.
+CREATE TABLE analytics_salts (
+    day DATE PRIMARY KEY,
+    salt VARCHAR(64) NOT NULL
+);
+
+CREATE TABLE analytics_visitors (
+    post_id VARCHAR(36) NOT NULL,
+    site_id VARCHAR(36) NOT NULL,
+    day DATE NOT NULL,
+    visitor_hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (post_id, day, visitor_hash),
+    CONSTRAINT analytics_visitors_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX analytics_visitors_site_id_day_idx ON analytics_visitors (site_id, day, visitor_hash);
+
+CREATE TABLE post_views_daily (
+    post_id VARCHAR(36) NOT NULL,
+    site_id VARCHAR(36) NOT NULL,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    unique_visitors INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, day),
+    CONSTRAINT post_views_daily_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE TABLE site_views_daily (
+    site_id VARCHAR(36) NOT NULL,
+    day DATE NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    unique_visitors INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (site_id, day),
+    CONSTRAINT site_views_daily_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE TABLE post_referrers_daily (
+    post_id VARCHAR(36) NOT NULL,
+    site_id VARCHAR(36) NOT NULL,
+    day DATE NOT NULL,
+    referrer VARCHAR(255) NOT NULL,
+    views INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, day, referrer),
+    CONSTRAINT post_referrers_daily_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX post_referrers_daily_site_id_day_idx ON post_referrers_daily (site_id, day);
@@ -0,0 +1,4 @@
+ALTER TABLE posts
+DROP COLUMN table_of_contents,
+DROP COLUMN reading_time,
+DROP COLUMN word_count;
@@ -0,0 +1,16 @@
+ALTER TABLE posts
+ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN reading_time INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN table_of_contents JSONB NOT NULL DEFAULT '[]';
+
+-- Heading anchors are only known to the renderer, so existing posts get their
+-- table of contents the next time they are saved
+UPDATE posts
+SET word_count = (
+    SELECT count(*)
+    FROM regexp_split_to_table(post_article_text(article_content), '\s+') AS w
+    WHERE w <> ''
+);
+
+UPDATE posts
+SET reading_time = ceil(word_count / 200.0);
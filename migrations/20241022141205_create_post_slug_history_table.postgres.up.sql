@@ -0,0 +1,35 @@
+CREATE TABLE post_slug_history (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL,
+    site_id VARCHAR(36) NOT NULL,
+    slug VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP,
+    UNIQUE(site_id, slug),
+    CONSTRAINT post_slug_history_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE,
+    CONSTRAINT post_slug_history_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX post_slug_history_post_id_idx ON post_slug_history (post_id);
+
+-- Slugs recorded in earlier revisions keep working for posts that were
+-- renamed before the history existed. The most recent owner wins.
+INSERT INTO post_slug_history (id, post_id, site_id, slug, created_at)
+SELECT DISTINCT ON (p.site_id, r.slug)
+    gen_random_uuid()::text, r.post_id, p.site_id, r.slug, r.created_at
+FROM post_revisions r
+INNER JOIN posts p
+ON r.post_id = p.id
+WHERE r.slug IS NOT NULL AND r.slug <> ''
+    AND NOT EXISTS (
+        SELECT 1 FROM posts live
+        WHERE live.site_id = p.site_id AND live.slug = r.slug
+    )
+ORDER BY p.site_id, r.slug, r.created_at DESC;
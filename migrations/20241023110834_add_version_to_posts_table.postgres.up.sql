@@ -0,0 +1,4 @@
+-- Bumped on every write to a post and exposed as its ETag, so concurrent
+-- editors notice each other instead of overwriting changes
+ALTER TABLE posts
+ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
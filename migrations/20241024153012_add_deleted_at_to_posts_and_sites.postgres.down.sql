@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS posts_deleted_at_idx;
+DROP INDEX IF EXISTS sites_deleted_at_idx;
+
+ALTER TABLE posts
+DROP COLUMN deleted_at;
+
+ALTER TABLE sites
+DROP COLUMN deleted_at;
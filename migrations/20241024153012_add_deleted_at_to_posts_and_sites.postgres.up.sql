@@ -0,0 +1,9 @@
+ALTER TABLE sites
+ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE posts
+ADD COLUMN deleted_at TIMESTAMP;
+
+-- The purge job looks for rows trashed before the retention cutoff
+CREATE INDEX sites_deleted_at_idx ON sites (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX posts_deleted_at_idx ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE post_previews (
+    id VARCHAR(36) PRIMARY KEY,
+    post_id VARCHAR(36) NOT NULL,
+    user_id VARCHAR(35),
+    max_views INTEGER NOT NULL,
+    view_count INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP,
+    CONSTRAINT post_previews_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX post_previews_post_id_created_at_idx ON post_previews (post_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Members-only posts are cut down to a preview for readers without an
+-- active subscription
+ALTER TABLE posts
+ADD COLUMN members_only BOOLEAN NOT NULL DEFAULT FALSE;
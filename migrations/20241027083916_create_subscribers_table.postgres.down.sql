@@ -0,0 +1,5 @@
+DROP TABLE newsletter_deliveries;
+
+DROP TABLE subscribers;
+
+DROP TYPE subscriber_status;
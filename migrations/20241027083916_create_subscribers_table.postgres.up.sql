@@ -0,0 +1,41 @@
+CREATE TYPE subscriber_status AS ENUM ('pending', 'confirmed', 'unsubscribed');
+
+CREATE TABLE subscribers (
+    id VARCHAR(36) PRIMARY KEY,
+    site_id VARCHAR(36) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    status subscriber_status NOT NULL DEFAULT 'pending',
+    confirm_token VARCHAR(64) UNIQUE,
+    unsubscribe_token VARCHAR(64) UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    confirm_sent_at TIMESTAMP,
+    confirmed_at TIMESTAMP,
+    unsubscribed_at TIMESTAMP,
+    CONSTRAINT subscribers_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE,
+    CONSTRAINT subscribers_site_id_email_key UNIQUE (site_id, email)
+);
+
+CREATE INDEX subscribers_site_id_status_idx ON subscribers (site_id, status, created_at);
+
+-- One row per post and subscriber that was mailed, so a post is never sent
+-- twice to the same reader, whoever publishes it
+CREATE TABLE newsletter_deliveries (
+    post_id VARCHAR(36) NOT NULL,
+    subscriber_id VARCHAR(36) NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, subscriber_id),
+    CONSTRAINT newsletter_deliveries_posts_id_fk
+        FOREIGN KEY (post_id)
+        REFERENCES posts(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE,
+    CONSTRAINT newsletter_deliveries_subscribers_id_fk
+        FOREIGN KEY (subscriber_id)
+        REFERENCES subscribers(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
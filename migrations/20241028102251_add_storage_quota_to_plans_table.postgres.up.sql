@@ -0,0 +1,8 @@
+-- Bytes of media a subscriber of the plan may store. Users without an
+-- active subscription get MEDIA_FREE_QUOTA_BYTES.
+ALTER TABLE plans
+ADD COLUMN storage_quota_bytes BIGINT NOT NULL DEFAULT 1073741824;
+
+UPDATE plans
+SET storage_quota_bytes = 10737418240
+WHERE plan_name = 'Profesional';
@@ -0,0 +1,24 @@
+CREATE TABLE media (
+    id VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(35) NOT NULL,
+    site_id VARCHAR(36) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    checksum VARCHAR(64) NOT NULL,
+    storage_key TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT media_users_id_fk
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE,
+    CONSTRAINT media_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX media_site_id_created_at_idx ON media (site_id, created_at, id);
+CREATE INDEX media_user_id_idx ON media (user_id);
@@ -0,0 +1,7 @@
+DROP FUNCTION media_image_set(TEXT);
+
+DROP TABLE media_variants;
+
+ALTER TABLE media
+DROP COLUMN width,
+DROP COLUMN height;
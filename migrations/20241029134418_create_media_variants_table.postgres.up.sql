@@ -0,0 +1,51 @@
+ALTER TABLE media
+ADD COLUMN width INTEGER,
+ADD COLUMN height INTEGER;
+
+-- Resized copies of image media. Variants made at upload time feed srcset,
+-- on-demand ones are only a cache for the resize endpoint.
+CREATE TABLE media_variants (
+    id VARCHAR(36) PRIMARY KEY,
+    media_id VARCHAR(36) NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    storage_key TEXT UNIQUE NOT NULL,
+    on_demand BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT media_variants_media_id_fk
+        FOREIGN KEY (media_id)
+        REFERENCES media(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE,
+    CONSTRAINT media_variants_media_id_name_key UNIQUE (media_id, name)
+);
+
+-- Looks up the upload-time variants of the media an image URL points at, so
+-- posts and sites can expose a srcset for their images. NULL for any other URL.
+CREATE FUNCTION media_image_set(url TEXT) RETURNS JSONB
+LANGUAGE SQL STABLE PARALLEL SAFE AS $$
+    SELECT jsonb_build_object(
+        'id', m.id,
+        'mime_type', m.mime_type,
+        'width', m.width,
+        'height', m.height,
+        'variants', COALESCE((
+            SELECT jsonb_agg(
+                jsonb_build_object(
+                    'name', v.name,
+                    'width', v.width,
+                    'height', v.height,
+                    'mime_type', v.mime_type
+                )
+                ORDER BY v.mime_type, v.width
+            )
+            FROM media_variants v
+            WHERE v.media_id = m.id AND NOT v.on_demand
+        ), '[]'::jsonb)
+    )
+    FROM media m
+    WHERE m.id = substring(url FROM '/media/([0-9a-f-]{36})/') AND m.width IS NOT NULL
+$$;
@@ -0,0 +1,3 @@
+ALTER TABLE posts
+DROP COLUMN publish_retry_at,
+DROP COLUMN publish_attempts;
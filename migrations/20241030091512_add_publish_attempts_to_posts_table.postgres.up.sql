@@ -0,0 +1,3 @@
+ALTER TABLE posts
+ADD COLUMN publish_attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN publish_retry_at TIMESTAMP;
@@ -0,0 +1 @@
+-- Merged topics and their old slugs cannot be restored.
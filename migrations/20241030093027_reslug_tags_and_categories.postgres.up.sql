@@ -0,0 +1,70 @@
+-- Tags and categories stored before accented letters were transliterated
+-- have slugs like 'cr-me', while new names slugify to 'creme'. Re-slug them
+-- the way helpers.Slugify does now and merge topics that end up the same.
+CREATE FUNCTION reslug_topic(name TEXT, slug TEXT) RETURNS TEXT AS $$
+    SELECT COALESCE(NULLIF(trim(BOTH '-' FROM regexp_replace(
+        regexp_replace(
+            normalize(
+                replace(replace(replace(replace(replace(replace(replace(replace(replace(
+                    lower(name),
+                    'ß', 'ss'), 'æ', 'ae'), 'œ', 'oe'), 'ø', 'o'), 'đ', 'd'), 'ð', 'd'),
+                    'ł', 'l'), 'þ', 'th'), 'ı', 'i'),
+                NFKD
+            ),
+            '[\u0300-\u036f]', '', 'g'
+        ),
+        '[^a-z0-9]+', '-', 'g'
+    )), ''), slug)
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- the oldest topic of each new slug is kept
+CREATE TEMPORARY TABLE tag_slugs AS
+SELECT id, new_slug, first_value(id) OVER (PARTITION BY site_id, new_slug ORDER BY created_at, id) AS keep_id
+FROM (SELECT id, site_id, created_at, reslug_topic(name, slug) AS new_slug FROM tags) t;
+
+INSERT INTO post_tags (post_id, tag_id)
+SELECT pt.post_id, ts.keep_id
+FROM post_tags pt
+INNER JOIN tag_slugs ts
+ON pt.tag_id = ts.id
+WHERE ts.id <> ts.keep_id
+ON CONFLICT DO NOTHING;
+
+DELETE FROM tags
+WHERE id IN (SELECT id FROM tag_slugs WHERE id <> keep_id);
+
+-- slugs are moved out of the way first, so renames cannot collide midway
+UPDATE tags t
+SET slug = t.id
+FROM tag_slugs ts
+WHERE t.id = ts.id AND t.slug <> ts.new_slug;
+
+UPDATE tags t
+SET slug = ts.new_slug
+FROM tag_slugs ts
+WHERE t.id = ts.id AND t.slug = t.id;
+
+CREATE TEMPORARY TABLE category_slugs AS
+SELECT id, new_slug, first_value(id) OVER (PARTITION BY site_id, new_slug ORDER BY created_at, id) AS keep_id
+FROM (SELECT id, site_id, created_at, reslug_topic(name, slug) AS new_slug FROM categories) c;
+
+UPDATE posts p
+SET category_id = cs.keep_id
+FROM category_slugs cs
+WHERE p.category_id = cs.id AND cs.id <> cs.keep_id;
+
+DELETE FROM categories
+WHERE id IN (SELECT id FROM category_slugs WHERE id <> keep_id);
+
+UPDATE categories c
+SET slug = c.id
+FROM category_slugs cs
+WHERE c.id = cs.id AND c.slug <> cs.new_slug;
+
+UPDATE categories c
+SET slug = cs.new_slug
+FROM category_slugs cs
+WHERE c.id = cs.id AND c.slug = c.id;
+
+DROP TABLE tag_slugs, category_slugs;
+DROP FUNCTION reslug_topic(TEXT, TEXT);
@@ -0,0 +1,3 @@
+CREATE INDEX analytics_visitors_site_id_day_idx ON analytics_visitors (site_id, day, visitor_hash);
+
+DROP TABLE analytics_site_visitors;
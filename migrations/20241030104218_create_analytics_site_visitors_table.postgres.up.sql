@@ -0,0 +1,19 @@
+-- Visitors of a site per day. Inserting a hash tells in one statement whether
+-- the reader is new to the site today, whichever of its posts they read.
+CREATE TABLE analytics_site_visitors (
+    site_id VARCHAR(36) NOT NULL,
+    day DATE NOT NULL,
+    visitor_hash VARCHAR(64) NOT NULL,
+    PRIMARY KEY (site_id, day, visitor_hash),
+    CONSTRAINT analytics_site_visitors_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+INSERT INTO analytics_site_visitors (site_id, day, visitor_hash)
+SELECT DISTINCT site_id, day, visitor_hash
+FROM analytics_visitors;
+
+DROP INDEX analytics_visitors_site_id_day_idx;
@@ -0,0 +1 @@
+DROP TABLE site_subdirectory_history;
@@ -0,0 +1,15 @@
+-- Subdirectories sites used to have, so links to a renamed site keep working.
+-- A subdirectory points at the last site that gave it up. The row is deleted
+-- when a site takes the subdirectory.
+CREATE TABLE site_subdirectory_history (
+    subdirectory VARCHAR(40) PRIMARY KEY,
+    site_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT site_subdirectory_history_sites_id_fk
+        FOREIGN KEY (site_id)
+        REFERENCES sites(id)
+        ON DELETE CASCADE
+        ON UPDATE CASCADE
+);
+
+CREATE INDEX site_subdirectory_history_site_id_idx ON site_subdirectory_history (site_id);
@@ -0,0 +1,7 @@
+DELETE FROM newsletter_deliveries WHERE sent_at IS NULL;
+
+ALTER TABLE newsletter_deliveries
+DROP COLUMN retry_at,
+DROP COLUMN last_error,
+DROP COLUMN attempts,
+ALTER COLUMN sent_at SET NOT NULL;
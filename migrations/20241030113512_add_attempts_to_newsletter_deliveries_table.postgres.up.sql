@@ -0,0 +1,5 @@
+ALTER TABLE newsletter_deliveries
+ALTER COLUMN sent_at DROP NOT NULL,
+ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN last_error TEXT,
+ADD COLUMN retry_at TIMESTAMP;
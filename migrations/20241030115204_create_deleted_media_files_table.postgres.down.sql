@@ -0,0 +1,4 @@
+DROP TRIGGER media_variants_record_deleted_file ON media_variants;
+DROP TRIGGER media_record_deleted_file ON media;
+DROP FUNCTION record_deleted_media_file();
+DROP TABLE deleted_media_files;
@@ -0,0 +1,24 @@
+-- Storage keys of media and variant rows that are gone, including rows removed
+-- by cascades from sites and users, until the trash purger deletes the files.
+CREATE TABLE deleted_media_files (
+    storage_key TEXT PRIMARY KEY,
+    deleted_at TIMESTAMP NOT NULL
+);
+
+CREATE FUNCTION record_deleted_media_file() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+    INSERT INTO deleted_media_files (storage_key, deleted_at)
+    VALUES (OLD.storage_key, now())
+    ON CONFLICT (storage_key) DO NOTHING;
+    RETURN OLD;
+END;
+$$;
+
+CREATE TRIGGER media_record_deleted_file
+AFTER DELETE ON media
+FOR EACH ROW EXECUTE FUNCTION record_deleted_media_file();
+
+CREATE TRIGGER media_variants_record_deleted_file
+AFTER DELETE ON media_variants
+FOR EACH ROW EXECUTE FUNCTION record_deleted_media_file();
@@ -0,0 +1,7 @@
+DROP TRIGGER categories_record_site_content_deleted ON categories;
+DROP TRIGGER tags_record_site_content_deleted ON tags;
+DROP TRIGGER posts_record_site_content_deleted ON posts;
+DROP FUNCTION record_site_content_deleted();
+
+ALTER TABLE sites
+DROP COLUMN content_deleted_at;
@@ -0,0 +1,27 @@
+-- When a post, tag or category of the site was last deleted for good. Its
+-- timestamps leave with the row, this keeps Last-Modified of the site's
+-- pages from going back in time.
+ALTER TABLE sites
+ADD COLUMN content_deleted_at TIMESTAMP;
+
+CREATE FUNCTION record_site_content_deleted() RETURNS TRIGGER
+LANGUAGE plpgsql AS $$
+BEGIN
+    UPDATE sites
+    SET content_deleted_at = now()
+    WHERE id = OLD.site_id;
+    RETURN OLD;
+END;
+$$;
+
+CREATE TRIGGER posts_record_site_content_deleted
+AFTER DELETE ON posts
+FOR EACH ROW EXECUTE FUNCTION record_site_content_deleted();
+
+CREATE TRIGGER tags_record_site_content_deleted
+AFTER DELETE ON tags
+FOR EACH ROW EXECUTE FUNCTION record_site_content_deleted();
+
+CREATE TRIGGER categories_record_site_content_deleted
+AFTER DELETE ON categories
+FOR EACH ROW EXECUTE FUNCTION record_site_content_deleted();